@@ -0,0 +1,167 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+// scheduler-bench generates openQA-like clusters and reports how long it
+// takes to build, convert and solve their formulas, and the memory used.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/scenario"
+	"github.com/mudler/openqa-scheduler-go/scheduler"
+)
+
+// Run is the report of a benchmark run
+type Run struct {
+	Workers   int           `json:"workers"`
+	Tests     int           `json:"tests"`
+	Seed      int64         `json:"seed"`
+	Variables int           `json:"variables"`
+	Clauses   int           `json:"clauses"`
+	BuildTime time.Duration `json:"build_time"`
+	CnfTime   time.Duration `json:"cnf_time"`
+	SolveTime time.Duration `json:"solve_time,omitempty"`
+	// Solved is false if the solve was skipped or timed out
+	Solved   bool                   `json:"solved"`
+	TimedOut bool                   `json:"timed_out,omitempty"`
+	Stats    *scheduler.SolverStats `json:"stats,omitempty"`
+	Assigned int                    `json:"assigned"`
+	Pending  int                    `json:"pending"`
+	// Alloc is the memory allocated to build the formula, Mallocs the number of allocations
+	Alloc   uint64 `json:"alloc_bytes"`
+	Mallocs uint64 `json:"mallocs"`
+	// HeapInUse is the heap in use once the formula is built
+	HeapInUse uint64 `json:"heap_inuse_bytes"`
+}
+
+func bench(size scenario.Size, seed int64, solve bool, timeout time.Duration) (*Run, error) {
+	sc := scenario.Cluster(rand.New(rand.NewSource(seed)), size)
+	s, err := sc.Scheduler()
+	if err != nil {
+		return nil, err
+	}
+	run := &Run{Workers: size.Workers, Tests: size.Tests, Seed: seed}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	f := s.BuildFormula()
+	run.BuildTime = time.Since(start)
+	runtime.ReadMemStats(&after)
+	run.Alloc = after.TotalAlloc - before.TotalAlloc
+	run.Mallocs = after.Mallocs - before.Mallocs
+	run.HeapInUse = after.HeapInuse
+
+	start = time.Now()
+	stats, err := scheduler.FormulaStats(f)
+	if err != nil {
+		return nil, err
+	}
+	run.CnfTime = time.Since(start)
+	run.Variables, run.Clauses = stats.Variables, stats.Clauses
+
+	if !solve {
+		return run, nil
+	}
+
+	type solved struct {
+		res *scheduler.ScheduleResult
+		err error
+	}
+	done := make(chan solved, 1)
+	go func() {
+		s, _ := sc.Scheduler()
+		res, err := s.Plan()
+		done <- solved{res, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return run, r.err
+		}
+		run.Solved = true
+		run.SolveTime = r.res.SolveTime
+		run.Stats = r.res.Stats
+		run.Assigned = len(r.res.Assigned)
+		run.Pending = len(r.res.Pending)
+	case <-time.After(timeout):
+		// The solver can't be interrupted, and keeps the solver lock until
+		// the process exits
+		run.TimedOut = true
+	}
+	return run, nil
+}
+
+func main() {
+	workers := flag.Int("workers", 200, "number of worker instances")
+	tests := flag.Int("tests", 1000, "number of queued tests")
+	perHost := flag.Int("per-host", 8, "worker instances per host")
+	mm := flag.Float64("mm", 0.2, "ratio of tests in multi-machine clusters")
+	seed := flag.Int64("seed", 1, "seed of the first generated cluster")
+	runs := flag.Int("runs", 1, "number of clusters generated, with consecutive seeds")
+	solve := flag.Bool("solve", true, "solve the formulas")
+	timeout := flag.Duration("timeout", time.Minute, "give up solving a formula after this long")
+	asJSON := flag.Bool("json", false, "print the reports as JSON")
+	flag.Parse()
+
+	size := scenario.Size{Workers: *workers, Tests: *tests, InstancesPerHost: *perHost, MultiMachine: *mm}
+	var reports []*Run
+	// Once a solve timed out the following ones would wait for it, skip them
+	timedOut := false
+	for i := 0; i < *runs; i++ {
+		run, err := bench(size, *seed+int64(i), *solve && !timedOut, *timeout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error", err)
+			os.Exit(1)
+		}
+		reports = append(reports, run)
+		if run.TimedOut && i < *runs-1 {
+			fmt.Fprintln(os.Stderr, "Warning: the solve of seed", run.Seed, "timed out and keeps running,",
+				"the solves of the following runs are skipped")
+		}
+		timedOut = timedOut || run.TimedOut
+		if !*asJSON {
+			solveTime := "skipped"
+			if run.Solved {
+				solveTime = fmt.Sprintf("%v (%d solves, %d conflicts, %d assigned, %d pending)",
+					run.SolveTime, run.Stats.Solves, run.Stats.Conflicts, run.Assigned, run.Pending)
+			} else if run.TimedOut {
+				solveTime = "timed out after " + timeout.String()
+			}
+			fmt.Printf("seed %d: %d workers, %d tests\n", run.Seed, run.Workers, run.Tests)
+			fmt.Printf("  formula: %d variables, %d clauses\n", run.Variables, run.Clauses)
+			fmt.Printf("  build:   %v, %d bytes in %d allocations, %d bytes of heap in use\n", run.BuildTime, run.Alloc, run.Mallocs, run.HeapInUse)
+			fmt.Printf("  cnf:     %v\n", run.CnfTime)
+			fmt.Printf("  solve:   %s\n", solveTime)
+		}
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	}
+}
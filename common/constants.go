@@ -16,6 +16,7 @@
 package common
 
 const STATE_RUNNING = "running"
+const STATE_PENDING = "pending"
 
 const AssignSep = "@"
 const AssignFmt = "%s" + AssignSep + "%s" + AssignSep + "%s"
@@ -32,6 +33,98 @@ const TestSep = "#"
 const TestParallelSep = ","
 const TestEncodeFormat = "%s" + TestSep + "%s" + TestSep + "%s" + TestSep + "%s"
 
+// worker states
+const WORKER_ONLINE = "online"
+const WORKER_DRAINING = "draining"
+const WORKER_OFFLINE = "offline"
+const WORKER_BROKEN = "broken"
+
 // sched states
 const STATE_OLD = "old"
 const STATE_CURRENT = "current"
+
+// host policies for parallel clusters
+const HOST_POLICY_ANY = "any"
+const HOST_POLICY_SAME = "same"
+const HOST_POLICY_SPREAD = "spread"
+
+const CounterSep = "!"
+const CounterFmt = "%s" + CounterSep + "%d" + CounterSep + "%d"
+const HostCapacityPrefix = "host_capacity" + CounterSep
+
+// rules between tests
+const RULE_AFFINITY = "affinity"
+const RULE_ANTI_AFFINITY = "anti_affinity"
+
+const RuleViolationFmt = "rule" + CounterSep + "%d" + CounterSep + "%s" + CounterSep + "%s"
+
+const PreemptFmt = "preempt" + CounterSep + "%d"
+
+const GroupQuotaPrefix = "group_quota" + CounterSep
+const GroupSharePrefix = "group_share" + CounterSep
+
+const WorkerCapacityPrefix = "worker_capacity" + CounterSep
+
+// operators of the requirements on worker properties
+const REQ_EQ = "=="
+const REQ_NE = "!="
+const REQ_LT = "<"
+const REQ_LE = "<="
+const REQ_GT = ">"
+const REQ_GE = ">="
+const REQ_IN = "in"
+const REQ_NOT_IN = "not in"
+
+// reasons for a test to stay pending
+const PENDING_NO_WORKER_CLASS = "no worker provides the worker class"
+const PENDING_NO_CAPABLE_WORKER = "no worker meets the requirements"
+const PENDING_NO_ONLINE_WORKER = "no online worker provides the worker class"
+const PENDING_GROUP_QUOTA = "job group quota reached"
+const PENDING_NO_FREE_WORKER = "waiting for a free worker"
+const PENDING_PARENT = "waiting for the parent test to finish"
+const PENDING_UNSATISFIABLE = "tests cannot be assigned to workers"
+const PENDING_INVALID = "invalid workers or tests"
+
+// results of a scheduling run, as reported by metrics
+const RUN_SAT = "sat"
+const RUN_UNSAT = "unsat"
+const RUN_ERROR = "error"
+
+// changes of a schedule to the running assignments, as reported by diffs
+const DIFF_ADDED = "added"
+const DIFF_KEPT = "kept"
+const DIFF_REVOKED = "revoked"
+const DIFF_RELEASED = "released"
+
+// problems found validating the workers and tests
+const INVALID_NAME = "invalid_name"
+const INVALID_DUPLICATE_WORKER = "duplicate_worker"
+const INVALID_DUPLICATE_TEST = "duplicate_test"
+const INVALID_SELF_PARALLEL = "self_parallel"
+const INVALID_UNKNOWN_PEER = "unknown_peer"
+const INVALID_UNKNOWN_PARENT = "unknown_parent"
+const INVALID_PARENT_CYCLE = "parent_cycle"
+const INVALID_HOST_POLICY = "invalid_host_policy"
+const INVALID_RULE_TYPE = "invalid_rule_type"
+const INVALID_CLASSES = "invalid_classes"
+const INVALID_NO_PENDING = "policy_without_pending"
+
+// openQA worker status, job states and settings
+const OPENQA_WORKER_IDLE = "idle"
+const OPENQA_WORKER_RUNNING = "running"
+const OPENQA_WORKER_DEAD = "dead"
+const OPENQA_WORKER_BROKEN = "broken"
+
+const OPENQA_JOB_SCHEDULED = "scheduled"
+const OPENQA_JOB_ASSIGNED = "assigned"
+const OPENQA_JOB_RUNNING = "running"
+const OPENQA_JOB_DONE = "done"
+
+const OPENQA_WORKER_CLASS = "WORKER_CLASS"
+const OPENQA_DEFAULT_PRIORITY = 50
+
+// openQA API authentication
+const OPENQA_HEADER_KEY = "X-API-Key"
+const OPENQA_HEADER_MICROTIME = "X-API-Microtime"
+const OPENQA_HEADER_HASH = "X-API-Hash"
+const OPENQA_MAX_CLOCK_SKEW = 300
@@ -18,6 +18,7 @@ package decoder
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -26,12 +27,20 @@ import (
 	encoder "github.com/mudler/openqa-scheduler-go/encoder"
 )
 
-type Decoder struct{}
+// Decoder decodes the assignments of a model. A strict decoder fails on
+// assignment variables it can't decode instead of skipping them, and if
+// collections are given, it resolves workers and tests to their objects.
+type Decoder struct {
+	Strict  bool
+	Workers *encoder.WorkerColl
+	Tests   *encoder.TestColl
+}
+
 type Assignment struct {
-	Worker *encoder.Worker
-	Test   *encoder.Test
-	State  string
-	Value  bool
+	Worker *encoder.Worker `json:"worker"`
+	Test   *encoder.Test   `json:"test"`
+	State  string          `json:"state"`
+	Value  bool            `json:"value"`
 }
 
 func (a *Assignment) Encode() string {
@@ -42,16 +51,67 @@ func NewDecoder() *Decoder {
 	return &Decoder{}
 }
 
+// NewCollectionDecoder returns a decoder resolving workers and tests to the
+// objects of the given collections
+func NewCollectionDecoder(workers *encoder.WorkerColl, tests *encoder.TestColl) *Decoder {
+	return &Decoder{Workers: workers, Tests: tests}
+}
+
+func NewStrictDecoder(workers *encoder.WorkerColl, tests *encoder.TestColl) *Decoder {
+	return &Decoder{Strict: true, Workers: workers, Tests: tests}
+}
+
+// VariableError is a model variable that couldn't be decoded
+type VariableError struct {
+	Variable string
+	Err      error
+}
+
+func (e *VariableError) Error() string {
+	return e.Variable + ": " + e.Err.Error()
+}
+
+// ModelError aggregates the errors met decoding a model
+type ModelError struct {
+	Errors []*VariableError
+}
+
+func (e *ModelError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, v := range e.Errors {
+		msgs[i] = v.Error()
+	}
+	return fmt.Sprintf("Decode error: %d undecodable variables: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// SortAssignments sorts ass by test, worker and state, so that decoding a
+// model doesn't depend on the map iteration order
+func SortAssignments(ass []*Assignment) {
+	sort.SliceStable(ass, func(i, j int) bool {
+		if ass[i].Test.Name != ass[j].Test.Name {
+			return ass[i].Test.Name < ass[j].Test.Name
+		}
+		if wi, wj := ass[i].Worker.Encode(), ass[j].Worker.Encode(); wi != wj {
+			return wi < wj
+		}
+		return ass[i].State < ass[j].State
+	})
+}
+
 func NewAssignment(t *encoder.Test, w *encoder.Worker, state string, value bool) *Assignment {
 	return &Assignment{Worker: w, Test: t, State: state, Value: value}
 }
+
+// DecodeTest decodes an encoded test. A bare test name is accepted as well.
 func DecodeTest(test string) (*encoder.Test, error) {
 	test_att := strings.Split(test, common.TestSep)
 	t := &encoder.Test{}
 
 	t.Name = test_att[0]
 
-	if len(test_att) > 2 {
+	switch len(test_att) {
+	case 1:
+	case 4:
 		test_worker_class := test_att[1]
 		test_parent := test_att[2]
 		test_parallel := test_att[3]
@@ -61,6 +121,8 @@ func DecodeTest(test string) (*encoder.Test, error) {
 		p := strings.Split(test_parallel, common.TestParallelSep)
 		t.WorkerClass = wc
 		t.Parallel = p
+	default:
+		return &encoder.Test{}, errors.New("Decode error: malformed test " + test)
 	}
 
 	return t, nil
@@ -68,10 +130,16 @@ func DecodeTest(test string) (*encoder.Test, error) {
 
 func DecodeWorker(worker string) (*encoder.Worker, error) {
 	worker_att := strings.Split(worker, common.WorkerSep)
+	if len(worker_att) != 2 {
+		return &encoder.Worker{}, errors.New("Decode error: malformed worker " + worker)
+	}
 	NameInstance := worker_att[0]
 	WorkerClasses := worker_att[1]
 
 	nameI := strings.Split(NameInstance, common.WorkerInstSep)
+	if len(nameI) != 2 {
+		return &encoder.Worker{}, errors.New("Decode error: malformed worker instance " + NameInstance)
+	}
 	wc := strings.Split(WorkerClasses, common.WorkerClassSep)
 	instance, err := strconv.Atoi(nameI[1])
 	if err != nil {
@@ -81,6 +149,58 @@ func DecodeWorker(worker string) (*encoder.Worker, error) {
 	return &encoder.Worker{Name: nameI[0], Instance: instance, WorkerClass: wc}, nil
 }
 
+// DecodeWorker decodes worker. If the decoder has a worker collection, it
+// returns the worker of the collection it was encoded from.
+func (d *Decoder) DecodeWorker(worker string) (*encoder.Worker, error) {
+	w, err := DecodeWorker(worker)
+	if err != nil {
+		return w, err
+	}
+	return d.resolveWorker(w)
+}
+
+// DecodeTest decodes test. If the decoder has a test collection, it returns
+// the test of the collection it was encoded from.
+func (d *Decoder) DecodeTest(test string) (*encoder.Test, error) {
+	t, err := DecodeTest(test)
+	if err != nil {
+		return t, err
+	}
+	return d.resolveTest(t)
+}
+
+func (d *Decoder) resolveWorker(w *encoder.Worker) (*encoder.Worker, error) {
+	if d.Workers == nil {
+		return w, nil
+	}
+	found := d.Workers.FindWorker(w.Name, w.Instance)
+	if found == nil {
+		return w, errors.New("Decode error: unknown worker " + w.Encode())
+	}
+	if found.Encode() != w.Encode() {
+		return w, errors.New("Decode error: worker " + w.Encode() + " doesn't match " + found.Encode())
+	}
+	return found, nil
+}
+
+func (d *Decoder) resolveTest(t *encoder.Test) (*encoder.Test, error) {
+	if d.Tests == nil {
+		return t, nil
+	}
+	found := d.Tests.FindTest(t.Name)
+	if found == nil {
+		return t, errors.New("Decode error: unknown test " + t.Encode())
+	}
+	if found.Encode() != t.Encode() {
+		return t, errors.New("Decode error: test " + t.Encode() + " doesn't match " + found.Encode())
+	}
+	return found, nil
+}
+
+// DecodeAssignment decodes assignment, resolving its worker and test to the
+// decoder collections. Assignments of the old state can refer to tests and
+// workers which are not in the collections anymore, so they keep the decoded
+// copies instead of failing.
 func (d *Decoder) DecodeAssignment(assignment string) (*Assignment, error) {
 	if !strings.Contains(assignment, common.AssignSep) {
 		return &Assignment{}, errors.New("Decode error: malformed string")
@@ -98,12 +218,60 @@ func (d *Decoder) DecodeAssignment(assignment string) (*Assignment, error) {
 		return &Assignment{}, err
 	}
 
+	current := data_row[2] == common.STATE_CURRENT
+	if rt, err := d.resolveTest(t); err == nil {
+		t = rt
+	} else if current {
+		return &Assignment{}, err
+	}
+	if rw, err := d.resolveWorker(w); err == nil {
+		w = rw
+	} else if current {
+		return &Assignment{}, err
+	}
+
 	// Assume true
 	return NewAssignment(t, w, data_row[2], true), nil
 }
 
 func (d *Decoder) DecodeModel(model map[string]bool) []*Assignment {
-	return DecodeModel(model)
+	if d.Workers == nil && d.Tests == nil {
+		return DecodeModel(model)
+	}
+	ass, _ := (&Decoder{Workers: d.Workers, Tests: d.Tests}).Decode(model)
+	return ass
+}
+
+// Decode returns the assignments of the current state in model, sorted. Variables
+// without the assignment separator are auxiliary ones (worker and test
+// encodings, task states, counters) and are skipped. Unless the decoder is
+// strict, so are assignment variables that fail decoding; a strict decoder
+// returns all of them in a ModelError instead.
+func (d *Decoder) Decode(model map[string]bool) ([]*Assignment, error) {
+	ass := make([]*Assignment, 0)
+	var errs []*VariableError
+
+	for k, v := range model {
+		if !strings.Contains(k, common.AssignSep) {
+			continue
+		}
+		a, err := d.DecodeAssignment(k)
+		if err != nil {
+			errs = append(errs, &VariableError{Variable: k, Err: err})
+			continue
+		}
+		a.Value = v
+		if a.State == common.STATE_CURRENT {
+			ass = append(ass, a)
+		}
+	}
+
+	SortAssignments(ass)
+	if d.Strict && len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Variable < errs[j].Variable })
+		return ass, &ModelError{Errors: errs}
+	}
+	return ass, nil
 }
 
 func DecodeModel(model map[string]bool) []*Assignment {
@@ -120,5 +288,6 @@ func DecodeModel(model map[string]bool) []*Assignment {
 			} // Else, there was a state transition between Initial state and current run
 		}
 	}
+	SortAssignments(ass)
 	return ass
 }
@@ -16,8 +16,10 @@
 package decoder
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/mudler/openqa-scheduler-go/common"
 	"github.com/mudler/openqa-scheduler-go/encoder"
 )
 
@@ -85,7 +87,7 @@ func TestWorkerDecode(t *testing.T) {
 	if w2.Name != "w1" {
 		t.Fatal("Test not added to the test list", w2)
 	}
-	if !w2.ProvidesWorkerClass("qemu32") {
+	if !w2.ProvidesWorkerClass("qemu32", nil) {
 		t.Fatal("Worker provides qemu32")
 	}
 }
@@ -106,7 +108,7 @@ func TestTestDecode(t *testing.T) {
 		t.Fatal("Test not added to the test list", w2)
 	}
 
-	if !w2.RequiresWorkerClass("qemu32") {
+	if !w2.RequiresWorkerClass("qemu32", nil) {
 		t.Fatal("Worker provides qemu32")
 	}
 }
@@ -149,3 +151,215 @@ func TestDecodeModel(t *testing.T) {
 		t.Error("DecodeModel gave result also if aren't current")
 	}
 }
+
+func TestDecodeSorted(t *testing.T) {
+	workers := encoder.NewWorkerColl()
+	w1 := workers.NewWorker("mudler")
+	w2 := workers.NewWorker("boss")
+	model := map[string]bool{}
+	for _, name := range []string{"lunch", "hiking", "dinner", "breakfast"} {
+		test := encoder.NewTest(name)
+		model[NewAssignment(test, w1, "current", true).Encode()] = true
+		model[NewAssignment(test, w2, "current", true).Encode()] = false
+	}
+
+	for i := 0; i < 10; i++ {
+		ass := DecodeModel(model)
+		if len(ass) != 8 {
+			t.Fatal("Failed decoding model", ass)
+		}
+		for j := 1; j < len(ass); j++ {
+			prev, cur := ass[j-1], ass[j]
+			if prev.Test.Name > cur.Test.Name || (prev.Test.Name == cur.Test.Name && prev.Worker.Encode() > cur.Worker.Encode()) {
+				t.Fatal("Decoded assignments not sorted", prev, cur)
+			}
+		}
+	}
+}
+
+func TestStrictDecode(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	w1 := workers.NewWorker("mudler")
+	w1.AddWorkerClass("developer")
+	t1 := tests.NewTest("lunch")
+	t1.AddWorkerClass("developer")
+
+	assignment := NewAssignment(t1, w1, "current", true)
+	model := map[string]bool{
+		assignment.Encode():     true,
+		w1.Encode():             true,
+		"lunch#developer##!run": true,
+	}
+
+	ass, err := NewStrictDecoder(workers, tests).Decode(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ass) != 1 || ass[0].Worker != w1 || ass[0].Test != t1 {
+		t.Error("Decoded assignment doesn't refer to the collections", ass)
+	}
+
+	model["lunch#developer##@mudler:x#developer@current"] = true
+	model["hiking#developer##@mudler:0#developer@current"] = false
+	model["lunch#developer##@mudler:0#qemu@current"] = false
+
+	ass, err = NewDecoder().Decode(model)
+	if err != nil || len(ass) != 3 {
+		t.Error("Non strict decoder should skip undecodable variables", ass, err)
+	}
+
+	_, err = NewStrictDecoder(workers, tests).Decode(model)
+	merr, ok := err.(*ModelError)
+	if !ok {
+		t.Fatal("Expected a model error", err)
+	}
+	if len(merr.Errors) != 3 {
+		t.Error("Wrong undecodable variables", merr)
+	}
+	if merr.Errors[0].Variable != "hiking#developer##@mudler:0#developer@current" {
+		t.Error("Undecodable variables not sorted", merr)
+	}
+}
+
+func TestCollectionDecode(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	w1 := workers.NewWorker("mudler")
+	w1.AddWorkerClass("developer")
+	w1.SetHost("home")
+	t1 := tests.NewTest("lunch")
+	t1.AddWorkerClass("developer")
+	t1.SetGroup("food")
+
+	d := NewCollectionDecoder(workers, tests)
+
+	w, err := d.DecodeWorker(w1.Encode())
+	if err != nil || w != w1 {
+		t.Error("Decoded worker is not the one of the collection", w, err)
+	}
+	test, err := d.DecodeTest(t1.Encode())
+	if err != nil || test != t1 {
+		t.Error("Decoded test is not the one of the collection", test, err)
+	}
+	if _, err := d.DecodeTest("hiking###"); err == nil {
+		t.Error("Decoded a test not in the collection")
+	}
+
+	a, err := d.DecodeAssignment(NewAssignment(t1, w1, "current", true).Encode())
+	if err != nil || a.Worker != w1 || a.Test != t1 || a.Worker.Host != "home" || a.Test.Group != "food" {
+		t.Error("Decoded assignment lost its worker or test", a, err)
+	}
+
+	running := encoder.NewTest("running")
+	a, err = d.DecodeAssignment(NewAssignment(running, w1, "old", true).Encode())
+	if err != nil || a.Worker != w1 || a.Test.Name != "running" {
+		t.Error("Old assignment of a test not in the collection not decoded", a, err)
+	}
+	if _, err = d.DecodeAssignment(NewAssignment(running, w1, "current", true).Encode()); err == nil {
+		t.Error("Decoded a current assignment of a test not in the collection")
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	for _, test := range []string{"lunch#developer", "lunch#developer#", "lunch#developer##,#", "a#b#c#d#e"} {
+		if _, err := DecodeTest(test); err == nil {
+			t.Error("Decoded malformed test", test)
+		}
+	}
+	for _, worker := range []string{"", "mudler", "mudler#developer", "mudler:1", "mudler:1#a#b", "mudler:1:2#a", "mudler:x#a"} {
+		if _, err := DecodeWorker(worker); err == nil {
+			t.Error("Decoded malformed worker", worker)
+		}
+	}
+	for _, a := range []string{"@@", "lunch#a#b@mudler@current", "lunch@mudler:1#a@current@"} {
+		if _, err := NewDecoder().DecodeAssignment(a); err == nil {
+			t.Error("Decoded malformed assignment", a)
+		}
+	}
+}
+
+func FuzzDecodeTest(f *testing.F) {
+	for _, seed := range []string{"", "lunch", "lunch###", "lunch#developer", "lunch#developer##", "lunch#qemu32,qemu64#cook#server,client", "a#b#c", "#", "##"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, test string) {
+		decoded, err := DecodeTest(test)
+		if err == nil && decoded == nil {
+			t.Error("No test and no error")
+		}
+	})
+}
+
+func FuzzDecodeWorker(f *testing.F) {
+	for _, seed := range []string{"", "mudler", "mudler:1#developer", "mudler:-1#", "mudler#", "mudler:1", ":#", "a:b:c#d#e"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, worker string) {
+		decoded, err := DecodeWorker(worker)
+		if err == nil && decoded == nil {
+			t.Error("No worker and no error")
+		}
+	})
+}
+
+func FuzzDecodeAssignment(f *testing.F) {
+	for _, seed := range []string{"", "@", "@@", "lunch###@mudler:0#developer@current", "lunch#a#b@mudler@old", "lunch###@mudler:0#@current@"} {
+		f.Add(seed)
+	}
+	workers := encoder.NewWorkerColl()
+	workers.NewWorker("mudler").AddWorkerClass("developer")
+	tests := encoder.NewTestColl()
+	tests.NewTest("lunch").AddWorkerClass("developer")
+
+	f.Fuzz(func(t *testing.T, assignment string) {
+		for _, d := range []*Decoder{NewDecoder(), NewStrictDecoder(workers, tests)} {
+			if a, err := d.DecodeAssignment(assignment); err == nil && (a.Test == nil || a.Worker == nil) {
+				t.Error("Decoded assignment without test or worker", assignment)
+			}
+			d.Decode(map[string]bool{assignment: true})
+		}
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add("lunch", "developer", "cook", "server,client", "mudler", 1, "qemu32,qemu64", "current")
+	f.Add("", "", "", "", "", 0, "", "")
+	f.Add("t", "a,,b", "p", ",", "w", -3, ",", "old")
+	f.Fuzz(func(t *testing.T, name, class, parent, parallel, worker string, instance int, workerClass, state string) {
+		for _, s := range []string{name, class, parent, parallel, worker, workerClass, state} {
+			if strings.ContainsAny(s, common.AssignSep+common.TestSep+common.WorkerInstSep) {
+				t.Skip()
+			}
+		}
+
+		test := &encoder.Test{Name: name, Parent: parent}
+		if class != "" {
+			test.WorkerClass = strings.Split(class, common.WorkerClassSep)
+		}
+		if parallel != "" {
+			test.Parallel = strings.Split(parallel, common.TestParallelSep)
+		}
+		w := &encoder.Worker{Name: worker, Instance: instance}
+		if workerClass != "" {
+			w.WorkerClass = strings.Split(workerClass, common.WorkerClassSep)
+		}
+
+		decodedTest, err := DecodeTest(test.Encode())
+		if err != nil || decodedTest.Encode() != test.Encode() || decodedTest.Name != name || decodedTest.Parent != parent {
+			t.Error("Test round trip failed", test.Encode(), decodedTest, err)
+		}
+		decodedWorker, err := DecodeWorker(w.Encode())
+		if err != nil || decodedWorker.Encode() != w.Encode() || decodedWorker.Name != worker || decodedWorker.Instance != instance {
+			t.Error("Worker round trip failed", w.Encode(), decodedWorker, err)
+		}
+
+		a := NewAssignment(test, w, state, true)
+		decoded, err := NewDecoder().DecodeAssignment(a.Encode())
+		if err != nil || decoded.Encode() != a.Encode() || decoded.State != state {
+			t.Error("Assignment round trip failed", a.Encode(), decoded, err)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mudler/openqa-scheduler-go/encoder"
+	"github.com/mudler/openqa-scheduler-go/scenario"
+)
+
+// diffCommand schedules a scenario file without applying anything, and
+// prints the assignments added, kept and revoked from its initial state
+func diffCommand(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the diff as JSON")
+	classes := flags.String("classes", "", "worker class registry file, replacing the one of the scenario")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: openqa-scheduler-go diff [-json] [-classes file] scenario.json")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	sc, err := scenario.Load(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error", err)
+		return 1
+	}
+	if *classes != "" {
+		if sc.Config.Classes, err = encoder.LoadClassRegistry(*classes); err != nil {
+			fmt.Fprintln(os.Stderr, "Error", err)
+			return 1
+		}
+	}
+	s, err := sc.Scheduler()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error", err)
+		return 1
+	}
+	d, err := s.Diff()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error", err)
+		return 1
+	}
+
+	if !*asJSON {
+		fmt.Print(d)
+		return 0
+	}
+	data, err := d.JSON()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error", err)
+		return 1
+	}
+	fmt.Println(string(data))
+	return 0
+}
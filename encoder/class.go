@@ -0,0 +1,274 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package encoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ClassRegistry is the taxonomy of worker classes: aliases name the same
+// class differently, and a class implies the classes it is a kind of, e.g.
+// qemu_x86_64 implies 64bit. A nil registry compares classes by name only.
+// It can be shared between schedulers, but must not be changed while in use.
+type ClassRegistry struct {
+	// Aliases maps an alias to the class it stands for
+	Aliases map[string]string `json:"aliases,omitempty"`
+	// Implies maps a class to the classes it implies
+	Implies map[string][]string `json:"implies,omitempty"`
+
+	mu sync.Mutex
+	// provided caches the classes provided by each class
+	provided map[string][]string
+}
+
+func NewClassRegistry() *ClassRegistry {
+	return &ClassRegistry{Aliases: make(map[string]string), Implies: make(map[string][]string)}
+}
+
+// ParseClassRegistry reads a registry from its JSON form and validates it
+func ParseClassRegistry(data []byte) (*ClassRegistry, error) {
+	r := NewClassRegistry()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(r); err != nil {
+		return nil, err
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LoadClassRegistry reads a registry from a JSON file
+func LoadClassRegistry(path string) (*ClassRegistry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := ParseClassRegistry(data)
+	if err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	return r, nil
+}
+
+func (r *ClassRegistry) AddAlias(alias, class string) {
+	r.Aliases[alias] = class
+	r.reset()
+}
+
+func (r *ClassRegistry) AddImplication(class string, implied ...string) {
+	r.Implies[class] = append(r.Implies[class], implied...)
+	r.reset()
+}
+
+func (r *ClassRegistry) reset() {
+	r.mu.Lock()
+	r.provided = nil
+	r.mu.Unlock()
+}
+
+// Canonical returns the class an alias stands for, following chains of aliases
+func (r *ClassRegistry) Canonical(class string) string {
+	if r == nil {
+		return class
+	}
+	for i := 0; i <= len(r.Aliases); i++ {
+		c, ok := r.Aliases[class]
+		if !ok {
+			break
+		}
+		class = c
+	}
+	return class
+}
+
+// closure returns the canonical class and all the classes it implies, sorted
+func (r *ClassRegistry) closure(class string) []string {
+	seen := map[string]bool{class: true}
+	queue := []string{class}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		for _, i := range r.Implies[c] {
+			if i = r.Canonical(i); !seen[i] {
+				seen[i] = true
+				queue = append(queue, i)
+			}
+		}
+	}
+	res := make([]string, 0, len(seen))
+	for c := range seen {
+		res = append(res, c)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Provided returns the canonical classes a worker of the given class provides
+func (r *ClassRegistry) Provided(class string) []string {
+	if r == nil {
+		return []string{class}
+	}
+	class = r.Canonical(class)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.provided[class]; ok {
+		return p
+	}
+	if r.provided == nil {
+		r.provided = make(map[string][]string)
+	}
+	r.provided[class] = r.closure(class)
+	return r.provided[class]
+}
+
+// Provides returns true if one of the classes of w is class, an alias of
+// class, or implies it
+func (r *ClassRegistry) Provides(w *Worker, class string) bool {
+	class = r.Canonical(class)
+	for _, w1 := range w.WorkerClass {
+		for _, c := range r.Provided(w1) {
+			if c == class {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Requires returns true if one of the classes of t is class or an alias of
+// class. Implications don't apply: a test requiring qemu_x86_64 can't run
+// on any 64bit worker.
+func (r *ClassRegistry) Requires(t *Test, class string) bool {
+	class = r.Canonical(class)
+	for _, c := range t.WorkerClass {
+		if r.Canonical(c) == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns true if w provides one of the classes of t
+func (r *ClassRegistry) Matches(w *Worker, t *Test) bool {
+	for _, w1 := range w.WorkerClass {
+		for _, c := range r.Provided(w1) {
+			if r.Requires(t, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Satisfies returns true if w provides one of the classes of t and meets its
+// requirements. Tests without classes only need the requirements met.
+func (r *ClassRegistry) Satisfies(w *Worker, t *Test) bool {
+	if len(t.WorkerClass) == 0 {
+		return len(t.Requirements) > 0 && w.Meets(t)
+	}
+	return r.Matches(w, t) && w.Meets(t)
+}
+
+// Validate returns an error if aliases or implications are cyclic, or
+// if an alias is used as a class with its own implications
+func (r *ClassRegistry) Validate() error {
+	var errs []string
+	for _, alias := range sortedStrings(r.Aliases) {
+		if r.Aliases[alias] == "" {
+			errs = append(errs, "alias "+alias+" of an empty class")
+			continue
+		}
+		path := []string{alias}
+		seen := map[string]bool{alias: true}
+		for c, ok := r.Aliases[alias]; ok; c, ok = r.Aliases[c] {
+			path = append(path, c)
+			if seen[c] {
+				errs = append(errs, "cyclic aliases "+strings.Join(path, " -> "))
+				break
+			}
+			seen[c] = true
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New("Invalid worker classes: " + strings.Join(errs, "; "))
+	}
+
+	for class := range r.Implies {
+		if _, ok := r.Aliases[class]; ok {
+			errs = append(errs, "alias "+class+" has implications, set them on "+r.Canonical(class))
+		}
+	}
+
+	// Depth first search of the implication graph between canonical classes
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var visit func(class string, path []string)
+	visit = func(class string, path []string) {
+		path = append(path, class)
+		switch state[class] {
+		case visiting:
+			errs = append(errs, "cyclic implications "+strings.Join(path, " -> "))
+			return
+		case done:
+			return
+		}
+		state[class] = visiting
+		implied := append([]string{}, r.Implies[class]...)
+		sort.Strings(implied)
+		for _, i := range implied {
+			visit(r.Canonical(i), path)
+		}
+		state[class] = done
+	}
+	for _, class := range sortedKeys(r.Implies) {
+		visit(class, nil)
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return errors.New("Invalid worker classes: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func sortedStrings(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
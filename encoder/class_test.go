@@ -0,0 +1,133 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package encoder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClassRegistry(t *testing.T) {
+	r := NewClassRegistry()
+	r.AddAlias("qemu64", "qemu_x86_64")
+	r.AddAlias("x86_64", "qemu64")
+	r.AddImplication("qemu_x86_64", "64bit")
+	if err := r.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Canonical("x86_64") != "qemu_x86_64" {
+		t.Error("Alias chain not followed", r.Canonical("x86_64"))
+	}
+	if p := strings.Join(r.Provided("qemu64"), ","); p != "64bit,qemu_x86_64" {
+		t.Error("Wrong provided classes", p)
+	}
+	// Changes apply to the classes already provided
+	r.AddImplication("64bit", "x86")
+	if p := strings.Join(r.Provided("qemu64"), ","); p != "64bit,qemu_x86_64,x86" {
+		t.Error("Wrong provided classes", p)
+	}
+
+	w := &Worker{Name: "w"}
+	w.AddWorkerClass("qemu64")
+	for _, c := range []string{"qemu_x86_64", "x86_64", "64bit", "x86"} {
+		if !r.Provides(w, c) {
+			t.Error("Worker doesn't provide", c)
+		}
+	}
+
+	test := &Test{Name: "t"}
+	test.AddWorkerClass("x86_64")
+	if !r.Requires(test, "qemu_x86_64") || r.Requires(test, "64bit") {
+		t.Error("Implications must not apply to required classes")
+	}
+	if !r.Satisfies(w, test) {
+		t.Error("Worker doesn't satisfy an alias of its class")
+	}
+
+	generic := &Worker{Name: "generic"}
+	generic.AddWorkerClass("64bit")
+	if r.Satisfies(generic, test) {
+		t.Error("Worker of an implied class satisfies the test")
+	}
+	test.AddWorkerClass("x86")
+	if !r.Satisfies(generic, test) {
+		t.Error("Worker doesn't satisfy a class implied by its own")
+	}
+
+	// The worker and test methods follow the registry they are given
+	if !w.ProvidesWorkerClass("x86", r) || !w.Satisfies(test, r) || !generic.MatchesWorkerClass(test, r) {
+		t.Error("Worker methods don't follow the registry")
+	}
+	if !test.RequiresWorkerClass("qemu64", r) || test.RequiresWorkerClass("64bit", r) {
+		t.Error("Test methods don't follow the registry aliases")
+	}
+
+	// Without a registry classes are compared by name
+	if w.ProvidesWorkerClass("64bit", nil) || w.Satisfies(test, nil) || !w.ProvidesWorkerClass("qemu64", nil) {
+		t.Error("Registry used without being given")
+	}
+	if generic.MatchesWorkerClass(test, nil) || test.RequiresWorkerClass("qemu64", nil) {
+		t.Error("Registry used without being given")
+	}
+	var none *ClassRegistry
+	if none.Provides(w, "64bit") || !none.Provides(generic, "64bit") {
+		t.Error("Nil registry doesn't compare classes by name")
+	}
+}
+
+func TestClassRegistryConcurrent(t *testing.T) {
+	r, err := ParseClassRegistry([]byte(`{"aliases": {"qemu64": "qemu_x86_64"}, "implies": {"qemu_x86_64": ["64bit"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Worker{Name: "w", WorkerClass: []string{"qemu64"}}
+
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		go func() {
+			done <- r.Provides(w, "64bit")
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		if !<-done {
+			t.Error("Worker doesn't provide an implied class")
+		}
+	}
+}
+
+func TestClassRegistryCycles(t *testing.T) {
+	for data, expected := range map[string]string{
+		`{"aliases": {"a": "b", "b": "a"}}`:                              "cyclic aliases a -> b -> a",
+		`{"aliases": {"a": "a"}}`:                                        "cyclic aliases a -> a",
+		`{"implies": {"a": ["b"], "b": ["c"], "c": ["a"]}}`:              "cyclic implications a -> b -> c -> a",
+		`{"aliases": {"c2": "c"}, "implies": {"c": ["d"], "d": ["c2"]}}`: "cyclic implications c -> d -> c",
+		`{"aliases": {"a": "b"}, "implies": {"a": ["c"]}}`:               "alias a has implications, set them on b",
+		`{"aliases": {"a": ""}}`:                                         "alias a of an empty class",
+	} {
+		_, err := ParseClassRegistry([]byte(data))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Error("Expected", expected, "from", data, "got", err)
+		}
+	}
+
+	if _, err := ParseClassRegistry([]byte(`{"alias": {}}`)); err == nil {
+		t.Error("Unknown field accepted")
+	}
+	if _, err := ParseClassRegistry([]byte(`{"implies": {"a": ["b"], "c": ["b"], "b": ["d"]}}`)); err != nil {
+		t.Error("Diamond rejected", err)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package encoder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+)
+
+// Properties are the capabilities a worker advertises, e.g. arch=x86_64,
+// kvm=true or memory_gb=64. Values are kept as strings, JSON booleans and
+// numbers are accepted.
+type Properties map[string]string
+
+func (p *Properties) UnmarshalJSON(data []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	props := make(Properties, len(raw))
+	for k, v := range raw {
+		switch v := v.(type) {
+		case string:
+			props[k] = v
+		case bool:
+			props[k] = strconv.FormatBool(v)
+		case float64:
+			props[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return fmt.Errorf("Property %s: %v is not a string, number or boolean", k, v)
+		}
+	}
+	*p = props
+	return nil
+}
+
+// Requirement is a predicate on a worker property, e.g. memory_gb >= 16
+// or arch in [x86_64, aarch64]. Workers without the property never meet it.
+type Requirement struct {
+	Property string
+	Op       string
+	Values   []string
+}
+
+var requirementRegexp = regexp.MustCompile(`^\s*([\w.\-]+)(?:\s*(==|=|!=|<=|>=|<|>)\s*|\s+(not\s+in|in)\s*)(.*?)\s*$`)
+
+// ParseRequirement parses a requirement of the form "property op value",
+// op being one of ==, =, !=, <, <=, >, >=, or "property [not] in [v1, v2]"
+func ParseRequirement(expr string) (*Requirement, error) {
+	m := requirementRegexp.FindStringSubmatch(expr)
+	if m == nil || m[4] == "" {
+		return nil, errors.New("Invalid requirement: " + expr)
+	}
+	r := &Requirement{Property: m[1], Op: m[2]}
+	if r.Op == "=" {
+		r.Op = common.REQ_EQ
+	}
+
+	if r.Op == "" {
+		r.Op = common.REQ_IN
+		if strings.HasPrefix(m[3], "not") {
+			r.Op = common.REQ_NOT_IN
+		}
+		list := m[4]
+		if !strings.HasPrefix(list, "[") || !strings.HasSuffix(list, "]") {
+			return nil, errors.New("Invalid requirement: " + expr + ", expected a list as [v1, v2]")
+		}
+		for _, v := range strings.Split(list[1:len(list)-1], ",") {
+			if v = unquote(v); v != "" {
+				r.Values = append(r.Values, v)
+			}
+		}
+		if len(r.Values) == 0 {
+			return nil, errors.New("Invalid requirement: " + expr + ", empty list")
+		}
+		return r, nil
+	}
+
+	r.Values = []string{unquote(m[4])}
+	switch r.Op {
+	case common.REQ_LT, common.REQ_LE, common.REQ_GT, common.REQ_GE:
+		if _, err := strconv.ParseFloat(r.Values[0], 64); err != nil {
+			return nil, errors.New("Invalid requirement: " + expr + ", " + r.Values[0] + " is not a number")
+		}
+	}
+	return r, nil
+}
+
+func unquote(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// String returns the requirement in the form parsed by ParseRequirement
+func (r *Requirement) String() string {
+	switch r.Op {
+	case common.REQ_IN, common.REQ_NOT_IN:
+		return r.Property + " " + r.Op + " [" + strings.Join(r.Values, ", ") + "]"
+	}
+	return r.Property + " " + r.Op + " " + strings.Join(r.Values, "")
+}
+
+func (r *Requirement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *Requirement) UnmarshalJSON(data []byte) error {
+	var expr string
+	if err := json.Unmarshal(data, &expr); err != nil {
+		return err
+	}
+	parsed, err := ParseRequirement(expr)
+	if err != nil {
+		return err
+	}
+	*r = *parsed
+	return nil
+}
+
+// sameValue compares property values, numerically if both are numbers
+func sameValue(a, b string) bool {
+	if a == b {
+		return true
+	}
+	x, err := strconv.ParseFloat(a, 64)
+	if err != nil {
+		return false
+	}
+	y, err := strconv.ParseFloat(b, 64)
+	return err == nil && x == y
+}
+
+func (r *Requirement) contains(v string) bool {
+	for _, v1 := range r.Values {
+		if sameValue(v, v1) {
+			return true
+		}
+	}
+	return false
+}
+
+// MetBy returns true if the properties meet the requirement
+func (r *Requirement) MetBy(p Properties) bool {
+	v, ok := p[r.Property]
+	if !ok {
+		return false
+	}
+	switch r.Op {
+	case common.REQ_EQ, common.REQ_IN:
+		return r.contains(v)
+	case common.REQ_NE, common.REQ_NOT_IN:
+		return !r.contains(v)
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || len(r.Values) != 1 {
+		return false
+	}
+	bound, err := strconv.ParseFloat(r.Values[0], 64)
+	if err != nil {
+		return false
+	}
+	switch r.Op {
+	case common.REQ_LT:
+		return n < bound
+	case common.REQ_LE:
+		return n <= bound
+	case common.REQ_GT:
+		return n > bound
+	case common.REQ_GE:
+		return n >= bound
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package encoder
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+)
+
+func TestParseRequirement(t *testing.T) {
+	for expr, expected := range map[string]string{
+		"arch = x86_64":                    "arch == x86_64",
+		"kvm==true":                        "kvm == true",
+		"gpu != none":                      "gpu != none",
+		"memory_gb >= 16":                  "memory_gb >= 16",
+		"cpus<4":                           "cpus < 4",
+		"arch in [x86_64, 'aarch64']":      "arch in [x86_64, aarch64]",
+		`os not in ["sle12", tumbleweed]`:  "os not in [sle12, tumbleweed]",
+		" os.version   in [15.1,15.2 ]   ": "os.version in [15.1, 15.2]",
+	} {
+		r, err := ParseRequirement(expr)
+		if err != nil {
+			t.Error(expr, err)
+			continue
+		}
+		if r.String() != expected {
+			t.Errorf("Parsed %q as %q, expected %q", expr, r.String(), expected)
+		}
+	}
+
+	for _, expr := range []string{"", "arch", "arch ==", "memory_gb >= lots", "arch in x86_64", "arch in []", "arch ~ x86_64"} {
+		if r, err := ParseRequirement(expr); err == nil {
+			t.Errorf("Expected %q to be invalid, got %q", expr, r.String())
+		}
+	}
+}
+
+func TestRequirementMetBy(t *testing.T) {
+	p := Properties{"arch": "x86_64", "kvm": "true", "memory_gb": "64", "gpu": "none"}
+	for expr, expected := range map[string]bool{
+		"arch == x86_64":           true,
+		"arch == aarch64":          false,
+		"arch in [x86_64,aarch64]": true,
+		"arch not in [s390x]":      true,
+		"kvm == true":              true,
+		"memory_gb >= 16":          true,
+		"memory_gb < 64":           false,
+		"memory_gb == 64.0":        true,
+		"gpu != none":              false,
+		"arch >= 1":                false,
+		"os == tumbleweed":         false,
+		"os != tumbleweed":         false,
+	} {
+		r, err := ParseRequirement(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.MetBy(p) != expected {
+			t.Error(expr, "expected", expected)
+		}
+	}
+}
+
+func TestWorkerProperties(t *testing.T) {
+	var w Worker
+	err := json.Unmarshal([]byte(`{"name": "w", "worker_class": ["qemu_x86_64"], "properties": {"arch": "x86_64", "kvm": true, "memory_gb": 64}}`), &w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Properties["kvm"] != "true" || w.Properties["memory_gb"] != "64" {
+		t.Error("Wrong properties", w.Properties)
+	}
+	if err := json.Unmarshal([]byte(`{"properties": {"disks": [1, 2]}}`), &Worker{}); err == nil {
+		t.Error("Non scalar property accepted")
+	}
+
+	var test Test
+	err = json.Unmarshal([]byte(`{"name": "t", "worker_class": ["qemu_x86_64"], "requirements": ["kvm == true", "memory_gb >= 16"]}`), &test)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(test.Requirements) != 2 || test.Requirements[1].Op != common.REQ_GE {
+		t.Fatal("Wrong requirements", test.Requirements)
+	}
+	if !w.Satisfies(&test, nil) {
+		t.Error("Worker doesn't satisfy the test")
+	}
+
+	if err := test.AddRequirement("memory_gb > 64"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Satisfies(&test, nil) || !w.MatchesWorkerClass(&test, nil) {
+		t.Error("Worker satisfies a test it lacks memory for")
+	}
+	w.SetProperty("memory_gb", "128")
+	if !w.Satisfies(&test, nil) {
+		t.Error("Worker doesn't satisfy the test")
+	}
+
+	test.WorkerClass = nil
+	if !w.Satisfies(&test, nil) {
+		t.Error("Test without classes not matched on its requirements")
+	}
+	test.Requirements = nil
+	if w.Satisfies(&test, nil) {
+		t.Error("Test without classes nor requirements matched")
+	}
+
+	data, err := json.Marshal(&Test{Name: "t", Requirements: []*Requirement{{Property: "arch", Op: common.REQ_IN, Values: []string{"x86_64", "aarch64"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"name":"t","requirements":["arch in [x86_64, aarch64]"]}` {
+		t.Error("Wrong encoding", string(data))
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package encoder
+
+import "github.com/mudler/openqa-scheduler-go/common"
+
+// Rule binds the placement of a group of tests on worker hosts.
+// A rule without weight is hard and must hold, otherwise the weight is the
+// penalty paid for each pair of tests violating it.
+type Rule struct {
+	Type   string   `json:"type"`
+	Tests  []string `json:"tests"`
+	Weight int      `json:"weight,omitempty"`
+}
+
+type RuleSet struct {
+	Rules []*Rule
+}
+
+func NewRuleSet() *RuleSet {
+	return &RuleSet{}
+}
+
+func (rs *RuleSet) NewRule(ruleType string, weight int, tests ...string) *Rule {
+	r := &Rule{Type: ruleType, Weight: weight, Tests: tests}
+	rs.AddRule(r)
+	return r
+}
+
+func (rs *RuleSet) AddRule(r *Rule) {
+	rs.Rules = append(rs.Rules, r)
+}
+
+// Affinity adds a rule keeping the tests on the same host
+func (rs *RuleSet) Affinity(weight int, tests ...string) *Rule {
+	return rs.NewRule(common.RULE_AFFINITY, weight, tests...)
+}
+
+// AntiAffinity adds a rule keeping the tests on different hosts
+func (rs *RuleSet) AntiAffinity(weight int, tests ...string) *Rule {
+	return rs.NewRule(common.RULE_ANTI_AFFINITY, weight, tests...)
+}
+
+func (r *Rule) IsHard() bool {
+	return r.Weight <= 0
+}
+
+func (r *Rule) Involves(test string) bool {
+	for _, t := range r.Tests {
+		if t == test {
+			return true
+		}
+	}
+	return false
+}
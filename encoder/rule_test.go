@@ -0,0 +1,42 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package encoder
+
+import (
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+)
+
+func TestRuleSet(t *testing.T) {
+	rs := NewRuleSet()
+
+	r := rs.AntiAffinity(0, "usb1", "usb2")
+	rs.Affinity(10, "nfs_server", "nfs_client")
+
+	if len(rs.Rules) != 2 || rs.Rules[0] != r {
+		t.Fatal("Rule not added to the rule set", rs.Rules)
+	}
+	if r.Type != common.RULE_ANTI_AFFINITY || !r.IsHard() {
+		t.Error("Wrong rule", r)
+	}
+	if rs.Rules[1].IsHard() {
+		t.Error("Weighted rule is not soft")
+	}
+	if !r.Involves("usb2") || r.Involves("nfs_server") {
+		t.Error("Wrong tests in rule", r.Tests)
+	}
+}
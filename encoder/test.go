@@ -16,8 +16,10 @@
 package encoder
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/mudler/openqa-scheduler-go/common"
 )
@@ -41,11 +43,60 @@ func (coll *TestColl) AddTest(t *Test) {
 	coll.Tests = append(coll.Tests, t)
 }
 
+// FindTest returns the test with the given name, or nil
+func (coll *TestColl) FindTest(name string) *Test {
+	for _, t := range coll.Tests {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
 type Test struct {
-	WorkerClass []string
-	Name        string
-	Parent      string
-	Parallel    []string
+	WorkerClass []string `json:"worker_class,omitempty"`
+	Name        string   `json:"name"`
+	Parent      string   `json:"parent,omitempty"`
+	Parallel    []string `json:"parallel,omitempty"`
+	HostPolicy  string   `json:"host_policy,omitempty"`
+	// Priority of the test, higher values are more urgent
+	Priority int `json:"priority,omitempty"`
+	// Group is the job group the test belongs to
+	Group string `json:"group,omitempty"`
+	// Submitted is when the test was queued
+	Submitted time.Time `json:"submitted,omitempty"`
+	// Deadline is when the test should have started at the latest
+	Deadline time.Time `json:"deadline,omitempty"`
+	// Started is when the test started running, for the tests of an initial state
+	Started time.Time `json:"started,omitempty"`
+	// Duration is how long the test is expected to run
+	Duration time.Duration `json:"duration,omitempty"`
+	// Assets are the assets the test needs on the worker
+	Assets []string `json:"assets,omitempty"`
+	// Requirements are the predicates the worker properties must meet
+	Requirements []*Requirement `json:"requirements,omitempty"`
+}
+
+// MarshalJSON leaves out the unset submission, deadline and start times,
+// which omitempty doesn't do for time.Time
+func (t Test) MarshalJSON() ([]byte, error) {
+	type test Test
+	aux := struct {
+		test
+		Submitted *time.Time `json:"submitted,omitempty"`
+		Deadline  *time.Time `json:"deadline,omitempty"`
+		Started   *time.Time `json:"started,omitempty"`
+	}{test: test(t)}
+	if !t.Submitted.IsZero() {
+		aux.Submitted = &t.Submitted
+	}
+	if !t.Deadline.IsZero() {
+		aux.Deadline = &t.Deadline
+	}
+	if !t.Started.IsZero() {
+		aux.Started = &t.Started
+	}
+	return json.Marshal(aux)
 }
 
 func NewTest(name string) *Test {
@@ -62,14 +113,26 @@ func (t *Test) AddWorkerClass(wc string) {
 	t.WorkerClass = append(t.WorkerClass, wc)
 }
 
-func (t *Test) RequiresWorkerClass(s string) bool {
-	for _, w := range t.WorkerClass {
-		if w == s {
-			return true
-		}
+// RequiresWorkerClass returns true if one of the test classes is s under
+// classes, following their aliases. Classes are compared by name if classes
+// is nil.
+func (t *Test) RequiresWorkerClass(s string, classes *ClassRegistry) bool {
+	return classes.Requires(t, s)
+}
+
+// AddRequirement parses expr, as in ParseRequirement, and adds it to the
+// requirements of the test
+func (t *Test) AddRequirement(expr string) error {
+	r, err := ParseRequirement(expr)
+	if err != nil {
+		return err
 	}
+	t.Requirements = append(t.Requirements, r)
+	return nil
+}
 
-	return false
+func (t *Test) AddAsset(a string) {
+	t.Assets = append(t.Assets, a)
 }
 
 func (t *Test) SetParent(p string) {
@@ -80,6 +143,45 @@ func (t *Test) AddParallel(p string) {
 	t.Parallel = append(t.Parallel, p)
 }
 
+func (t *Test) SetPriority(p int) {
+	t.Priority = p
+}
+
+func (t *Test) SetSubmitted(at time.Time) {
+	t.Submitted = at
+}
+
+func (t *Test) SetDeadline(at time.Time) {
+	t.Deadline = at
+}
+
+func (t *Test) SetStarted(at time.Time) {
+	t.Started = at
+}
+
+func (t *Test) SetDuration(d time.Duration) {
+	t.Duration = d
+}
+
+func (t *Test) HasDeadline() bool {
+	return !t.Deadline.IsZero()
+}
+
+// Slack returns how much time is left at now before the deadline of the test
+func (t *Test) Slack(now time.Time) time.Duration {
+	return t.Deadline.Sub(now)
+}
+
+func (t *Test) SetGroup(g string) {
+	t.Group = g
+}
+
+// SetHostPolicy sets how the parallel cluster of the test is placed on hosts,
+// see common.HOST_POLICY_*
+func (t *Test) SetHostPolicy(p string) {
+	t.HostPolicy = p
+}
+
 func (t *Test) Encode() string {
 	w_class := strings.Join(t.WorkerClass, common.WorkerClassSep)
 	p := strings.Join(t.Parallel, common.TestParallelSep)
@@ -15,7 +15,11 @@
 
 package encoder
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
 
 func TestAdd(t *testing.T) {
 	t1 := NewTest("t1")
@@ -45,4 +49,47 @@ func TestTestsColl(t *testing.T) {
 		t.Error("Test not added to collection")
 	}
 
+	if coll.FindTest("t1") != coll.Tests[0] {
+		t.Error("Test not found in collection")
+	}
+	if coll.FindTest("t2") != nil {
+		t.Error("Found a test not in the collection")
+	}
+
+}
+
+func TestDeadline(t *testing.T) {
+	t1 := NewTest("t1")
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if t1.HasDeadline() {
+		t.Error("Test without deadline")
+	}
+	t1.SetDeadline(now.Add(time.Hour))
+	if !t1.HasDeadline() || t1.Slack(now) != time.Hour {
+		t.Error("Wrong slack", t1.Slack(now))
+	}
+}
+
+func TestTestJSON(t *testing.T) {
+	t1 := &Test{Name: "t1"}
+	data, err := json.Marshal(t1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"name":"t1"}` {
+		t.Error("Unset times encoded", string(data))
+	}
+
+	t1.SetDeadline(time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC))
+	if data, err = json.Marshal(t1); err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"name":"t1","deadline":"2018-01-01T12:00:00Z"}` {
+		t.Error("Wrong encoding", string(data))
+	}
+	t2 := &Test{}
+	if err := json.Unmarshal(data, t2); err != nil || !t2.Deadline.Equal(t1.Deadline) || !t2.Submitted.IsZero() {
+		t.Error("Wrong decoding", t2, err)
+	}
 }
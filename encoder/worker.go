@@ -42,10 +42,35 @@ func (coll *WorkerColl) AddWorker(t *Worker) {
 	coll.Workers = append(coll.Workers, t)
 }
 
+// FindWorker returns the worker instance with the given name, or nil
+func (coll *WorkerColl) FindWorker(name string, instance int) *Worker {
+	for _, w := range coll.Workers {
+		if w.Name == name && w.Instance == instance {
+			return w
+		}
+	}
+	return nil
+}
+
+// Hosts groups the worker instances by the host they are running on
+func (coll *WorkerColl) Hosts() map[string][]*Worker {
+	hosts := make(map[string][]*Worker)
+	for _, w := range coll.Workers {
+		hosts[w.GetHost()] = append(hosts[w.GetHost()], w)
+	}
+	return hosts
+}
+
 type Worker struct {
-	Name        string
-	Instance    int
-	WorkerClass []string
+	Name        string   `json:"name"`
+	Instance    int      `json:"instance"`
+	WorkerClass []string `json:"worker_class,omitempty"`
+	Host        string   `json:"host,omitempty"`
+	Status      string   `json:"status,omitempty"`
+	// Assets are the assets (HDD images, ISOs, ...) cached on the worker
+	Assets []string `json:"assets,omitempty"`
+	// Properties are the capabilities the worker advertises
+	Properties Properties `json:"properties,omitempty"`
 }
 
 func NewWorker(name string) *Worker {
@@ -58,25 +83,95 @@ func AddWorker(w *Worker) {
 	workers = append(workers, w)
 }
 
-func (w *Worker) ProvidesWorkerClass(s string) bool {
-	for _, w1 := range w.WorkerClass {
-		if w1 == s {
-			return true
+// ProvidesWorkerClass returns true if the worker provides the class s under
+// classes, following their aliases and implications. Classes are compared by
+// name if classes is nil.
+func (w *Worker) ProvidesWorkerClass(s string, classes *ClassRegistry) bool {
+	return classes.Provides(w, s)
+}
+
+// Satisfies returns true if the worker provides one of the classes of t under
+// classes, nil to compare them by name, and meets its requirements. Tests
+// without classes only need the requirements met.
+func (w *Worker) Satisfies(t *Test, classes *ClassRegistry) bool {
+	return classes.Satisfies(w, t)
+}
+
+// MatchesWorkerClass returns true if the worker provides one of the classes
+// of t under classes, nil to compare them by name
+func (w *Worker) MatchesWorkerClass(t *Test, classes *ClassRegistry) bool {
+	return classes.Matches(w, t)
+}
+
+// Meets returns true if the worker properties meet all the requirements of t
+func (w *Worker) Meets(t *Test) bool {
+	for _, r := range t.Requirements {
+		if !r.MetBy(w.Properties) {
+			return false
 		}
 	}
+	return true
+}
 
-	return false
+func (w *Worker) SetProperty(key, value string) {
+	if w.Properties == nil {
+		w.Properties = make(Properties)
+	}
+	w.Properties[key] = value
 }
 
-func (w *Worker) Satisfies(t *Test) bool {
-	for _, w1 := range w.WorkerClass {
-		if t.RequiresWorkerClass(w1) {
+// GetHost returns the host of the worker instance. Instances without an explicit
+// host are grouped by worker name, as openQA does with "host:instance".
+func (w *Worker) GetHost() string {
+	if w.Host == "" {
+		return w.Name
+	}
+	return w.Host
+}
+
+func (w *Worker) SetHost(h string) {
+	w.Host = h
+}
+
+func (w *Worker) SetStatus(st string) {
+	w.Status = st
+}
+
+// AcceptsJobs returns true if new tests can be assigned to the worker.
+// Workers without a status are considered online.
+func (w *Worker) AcceptsJobs() bool {
+	return w.Status == "" || w.Status == common.WORKER_ONLINE
+}
+
+// IsOffline returns true if the worker can't carry on its running tests
+func (w *Worker) IsOffline() bool {
+	return w.Status == common.WORKER_OFFLINE || w.Status == common.WORKER_BROKEN
+}
+
+func (w *Worker) AddAsset(a string) {
+	w.Assets = append(w.Assets, a)
+}
+
+func (w *Worker) HasAsset(a string) bool {
+	for _, a1 := range w.Assets {
+		if a1 == a {
 			return true
 		}
 	}
 	return false
 }
 
+// MissingAssets returns how many assets required by t the worker has to download
+func (w *Worker) MissingAssets(t *Test) int {
+	missing := 0
+	for _, a := range t.Assets {
+		if !w.HasAsset(a) {
+			missing++
+		}
+	}
+	return missing
+}
+
 func (w *Worker) AddWorkerClass(wc string) {
 	w.WorkerClass = append(w.WorkerClass, wc)
 }
@@ -15,7 +15,11 @@
 
 package encoder
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+)
 
 func TestWorkerAdd(t *testing.T) {
 	w := NewWorker("w1")
@@ -48,8 +52,71 @@ func TestWorkerColl(t *testing.T) {
 		t.Error("Worker not added to collection")
 	}
 
-	if !w1.Satisfies(t1) {
+	if !w1.Satisfies(t1, nil) {
 		t.Error("Worker doesn't satisfies the test")
 	}
 
 }
+
+func TestWorkerHosts(t *testing.T) {
+	coll := NewWorkerColl()
+
+	w1 := coll.NewWorker("host1")
+	w1.Instance = 1
+	w2 := coll.NewWorker("host1")
+	w2.Instance = 2
+	w3 := coll.NewWorker("w3")
+	w3.SetHost("host2")
+
+	if w1.GetHost() != "host1" || w3.GetHost() != "host2" {
+		t.Error("Wrong host", w1.GetHost(), w3.GetHost())
+	}
+
+	hosts := coll.Hosts()
+	if len(hosts["host1"]) != 2 || len(hosts["host2"]) != 1 {
+		t.Error("Wrong host grouping", hosts)
+	}
+
+	if coll.FindWorker("host1", 2) != w2 {
+		t.Error("Worker instance not found")
+	}
+	if coll.FindWorker("host1", 3) != nil {
+		t.Error("Found a worker instance not in the collection")
+	}
+}
+
+func TestWorkerStatus(t *testing.T) {
+	w := NewWorker("w1")
+
+	if !w.AcceptsJobs() || w.IsOffline() {
+		t.Error("Worker without status is not online")
+	}
+
+	w.SetStatus(common.WORKER_DRAINING)
+	if w.AcceptsJobs() || w.IsOffline() {
+		t.Error("Draining worker should keep its jobs and get no new ones")
+	}
+
+	for _, st := range []string{common.WORKER_OFFLINE, common.WORKER_BROKEN} {
+		w.SetStatus(st)
+		if w.AcceptsJobs() || !w.IsOffline() {
+			t.Error("Worker is not offline", st)
+		}
+	}
+}
+
+func TestWorkerAssets(t *testing.T) {
+	w := NewWorker("w1")
+	w.AddAsset("sle-15.qcow2")
+
+	t1 := NewTest("t1")
+	t1.AddAsset("sle-15.qcow2")
+	t1.AddAsset("sle-15.iso")
+
+	if !w.HasAsset("sle-15.qcow2") || w.HasAsset("sle-15.iso") {
+		t.Error("Wrong cached assets", w.Assets)
+	}
+	if w.MissingAssets(t1) != 1 {
+		t.Error("Wrong missing assets", w.MissingAssets(t1))
+	}
+}
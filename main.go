@@ -2,12 +2,42 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	encoder "github.com/mudler/openqa-scheduler-go/encoder"
 	scheduler "github.com/mudler/openqa-scheduler-go/scheduler"
 )
 
+// commands are the subcommands, taking their arguments and returning the exit code
+var commands = map[string]func(args []string) int{
+	"diff":     diffCommand,
+	"run":      runCommand,
+	"validate": validateCommand,
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: openqa-scheduler-go [command] [arguments]")
+	fmt.Fprintln(os.Stderr, "Without command, schedules an example set of tests.")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  diff       show what scheduling a scenario would change")
+	fmt.Fprintln(os.Stderr, "  run        schedule the jobs of an openQA instance and assign them")
+	fmt.Fprintln(os.Stderr, "  validate   check the workers and tests of scenarios")
+}
+
 func main() {
+	if len(os.Args) < 2 {
+		example()
+		return
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(cmd(os.Args[2:]))
+}
+
+func example() {
 	tests := encoder.NewTestColl()
 	workers := encoder.NewWorkerColl()
 
@@ -41,15 +71,13 @@ func main() {
 	t4.AddWorkerClass("qemu64")
 
 	s := scheduler.NewScheduler(workers, tests)
-	model, err := s.ScheduleDecode()
+	res, err := s.Plan()
 	if err != nil {
 		fmt.Println("Error", err)
 		return
 	}
-	for _, a := range model {
-		if a.Value {
-			fmt.Println("Test:", a.Test.Name, "Assigned to worker:", a.Worker.Name)
-		}
+	for _, a := range res.Assigned {
+		fmt.Println("Test:", a.Test.Name, "Assigned to worker:", a.Worker.Name)
 	}
 
 }
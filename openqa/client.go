@@ -0,0 +1,230 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+// Package openqa talks to the openQA HTTP API: it imports the workers and
+// scheduled jobs to schedule them, and dispatches the assignments back.
+package openqa
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+)
+
+// Worker is a worker of the API
+type Worker struct {
+	ID       int    `json:"id"`
+	Host     string `json:"host"`
+	Instance int    `json:"instance"`
+	Status   string `json:"status"`
+	// JobID is the job the worker is busy with, if any
+	JobID      int               `json:"jobid,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// Dependencies are the jobs a job depends on, or which depend on it
+type Dependencies struct {
+	Chained         []int `json:"Chained,omitempty"`
+	DirectlyChained []int `json:"Directly chained,omitempty"`
+	Parallel        []int `json:"Parallel,omitempty"`
+}
+
+// Job is a job of the API
+type Job struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+	// Priority of the job, lower values are more urgent
+	Priority         int               `json:"priority"`
+	Group            string            `json:"group,omitempty"`
+	Created          string            `json:"t_created,omitempty"`
+	Started          string            `json:"t_started,omitempty"`
+	AssignedWorkerID int               `json:"assigned_worker_id,omitempty"`
+	Settings         map[string]string `json:"settings,omitempty"`
+	Parents          Dependencies      `json:"parents"`
+	Children         Dependencies      `json:"children"`
+}
+
+// Client is a client of the API of the openQA instance at URL. Requests are
+// signed if Key is set, as openQA expects for the API calls changing jobs.
+type Client struct {
+	URL    string
+	HTTP   *http.Client
+	Key    string
+	Secret string
+	// Now returns the current time, time.Now if nil
+	Now func() time.Time
+}
+
+func NewClient(url string) *Client {
+	return &Client{URL: strings.TrimSuffix(url, "/"), HTTP: http.DefaultClient}
+}
+
+// Error is an error answered by the API
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("openQA error %d: %s", e.Status, e.Message)
+}
+
+// Hash returns the signature of a request to pathQuery, the path with the
+// unescaped query, at the microtime timestamp: the hex HMAC-SHA1 of both
+func Hash(pathQuery, microtime, secret string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(pathQuery + microtime))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sign adds the API key, the timestamp and the signature to req
+func (c *Client) sign(req *http.Request) error {
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+	t := now()
+	microtime := fmt.Sprintf("%d.%06d", t.Unix(), t.Nanosecond()/1000)
+	pathQuery := req.URL.Path
+	if req.URL.RawQuery != "" {
+		query, err := url.QueryUnescape(req.URL.RawQuery)
+		if err != nil {
+			return err
+		}
+		pathQuery += "?" + query
+	}
+	req.Header.Set(common.OPENQA_HEADER_KEY, c.Key)
+	req.Header.Set(common.OPENQA_HEADER_MICROTIME, microtime)
+	req.Header.Set(common.OPENQA_HEADER_HASH, Hash(pathQuery, microtime, c.Secret))
+	return nil
+}
+
+// do sends the request and decodes the answer into v
+func (c *Client) do(req *http.Request, v interface{}) error {
+	if c.Key != "" {
+		if err := c.sign(req); err != nil {
+			return err
+		}
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var answer struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &answer) != nil || answer.Error == "" {
+			answer.Error = strings.TrimSpace(string(data))
+		}
+		return &Error{Status: resp.StatusCode, Message: answer.Error}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// request sends a request without body, the parameters are in the query so
+// that they are signed
+func (c *Client) request(ctx context.Context, method, path string, query url.Values, v interface{}) error {
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.URL+path, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, v)
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	return c.request(ctx, http.MethodGet, path, query, v)
+}
+
+func (c *Client) post(ctx context.Context, path string, query url.Values, v interface{}) error {
+	return c.request(ctx, http.MethodPost, path, query, v)
+}
+
+// Workers returns all the workers
+func (c *Client) Workers(ctx context.Context) ([]*Worker, error) {
+	var answer struct {
+		Workers []*Worker `json:"workers"`
+	}
+	err := c.get(ctx, "/api/v1/workers", nil, &answer)
+	return answer.Workers, err
+}
+
+// Jobs returns the jobs in one of the states, all the jobs if none is given
+func (c *Client) Jobs(ctx context.Context, states ...string) ([]*Job, error) {
+	query := url.Values{}
+	if len(states) > 0 {
+		query.Set("state", strings.Join(states, ","))
+	}
+	var answer struct {
+		Jobs []*Job `json:"jobs"`
+	}
+	err := c.get(ctx, "/api/v1/jobs", query, &answer)
+	return answer.Jobs, err
+}
+
+// Job returns the job with the given id
+func (c *Client) Job(ctx context.Context, id int) (*Job, error) {
+	var answer struct {
+		Job *Job `json:"job"`
+	}
+	err := c.get(ctx, "/api/v1/jobs/"+strconv.Itoa(id), nil, &answer)
+	return answer.Job, err
+}
+
+// Assign assigns the scheduled job to the idle worker by POST
+// /api/v1/jobs/{id}/assign. Assigning a job again to the same worker
+// succeeds.
+//
+// The openQA API has no such route: its own scheduler assigns the jobs
+// internally and sends them to the workers over their websocket. This route
+// and the one of Unassign must be added to the instance, e.g. by a plugin,
+// to let this scheduler replace the one of openQA. openqatest.Server serves
+// both as expected.
+func (c *Client) Assign(ctx context.Context, jobID, workerID int) error {
+	query := url.Values{"worker_id": {strconv.Itoa(workerID)}}
+	return c.post(ctx, "/api/v1/jobs/"+strconv.Itoa(jobID)+"/assign", query, nil)
+}
+
+// Unassign puts the job assigned to the worker back to scheduled by POST
+// /api/v1/jobs/{id}/unassign, as openQA does when a worker doesn't pick its
+// job up. Unassigning a scheduled job succeeds, one the worker picked up
+// fails with a conflict.
+func (c *Client) Unassign(ctx context.Context, jobID, workerID int) error {
+	query := url.Values{"worker_id": {strconv.Itoa(workerID)}}
+	return c.post(ctx, "/api/v1/jobs/"+strconv.Itoa(jobID)+"/unassign", query, nil)
+}
@@ -0,0 +1,141 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package openqa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/mudler/openqa-scheduler-go/decoder"
+)
+
+// DispatchError is the failure of dispatching an assignment, or of revoking it
+type DispatchError struct {
+	JobID  int
+	Worker string
+	Err    error
+}
+
+func (e *DispatchError) Error() string {
+	return fmt.Sprintf("Dispatch error: job %d to worker %s: %v", e.JobID, e.Worker, e.Err)
+}
+
+func (e *DispatchError) Unwrap() error {
+	return e.Err
+}
+
+// Dispatcher assigns the jobs to the workers through the API, for the
+// scheduling loop, and implements scheduler.Revoker to put them back to
+// scheduled. Dispatching is idempotent: every assignment is sent, and
+// one the API refuses as conflicting succeeds if the job turns out to be
+// assigned to the worker already, e.g. when the answer to a previous
+// attempt was lost. Nothing is cached about the jobs, as openQA may put
+// them back to scheduled with the same id.
+type Dispatcher struct {
+	Client *Client
+
+	mu sync.Mutex
+	// workerIDs maps the worker names and instances to their ids
+	workerIDs map[string]int
+}
+
+func NewDispatcher(c *Client) *Dispatcher {
+	return &Dispatcher{Client: c, workerIDs: make(map[string]int)}
+}
+
+func workerKey(name string, instance int) string {
+	return name + ":" + strconv.Itoa(instance)
+}
+
+// workerID returns the id of the worker, fetching the workers if it's unknown
+func (d *Dispatcher) workerID(ctx context.Context, name string, instance int) (int, error) {
+	key := workerKey(name, instance)
+	d.mu.Lock()
+	id, ok := d.workerIDs[key]
+	d.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	workers, err := d.Client.Workers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, w := range workers {
+		d.workerIDs[workerKey(w.Host, w.Instance)] = w.ID
+	}
+	if id, ok = d.workerIDs[key]; !ok {
+		return 0, errors.New("unknown worker")
+	}
+	return id, nil
+}
+
+// Dispatch assigns the job of a to its worker. Errors are *DispatchError.
+func (d *Dispatcher) Dispatch(ctx context.Context, a *decoder.Assignment) error {
+	jobID, err := strconv.Atoi(a.Test.Name)
+	if err != nil {
+		return &DispatchError{Worker: workerKey(a.Worker.Name, a.Worker.Instance), Err: errors.New("test " + a.Test.Name + " is not a job")}
+	}
+	fail := func(err error) error {
+		return &DispatchError{JobID: jobID, Worker: workerKey(a.Worker.Name, a.Worker.Instance), Err: err}
+	}
+	workerID, err := d.workerID(ctx, a.Worker.Name, a.Worker.Instance)
+	if err != nil {
+		return fail(err)
+	}
+
+	err = d.Client.Assign(ctx, jobID, workerID)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusConflict {
+		if j, jerr := d.Client.Job(ctx, jobID); jerr == nil && j.AssignedWorkerID == workerID {
+			err = nil
+		}
+	}
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		// The worker may be registered again, its id is fetched on retries
+		d.mu.Lock()
+		delete(d.workerIDs, workerKey(a.Worker.Name, a.Worker.Instance))
+		d.mu.Unlock()
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+// Revoke puts the job of a back to scheduled if it's still assigned to its
+// worker. Revoking a job which is scheduled already succeeds. Errors are
+// *DispatchError.
+func (d *Dispatcher) Revoke(ctx context.Context, a *decoder.Assignment) error {
+	jobID, err := strconv.Atoi(a.Test.Name)
+	if err != nil {
+		return &DispatchError{Worker: workerKey(a.Worker.Name, a.Worker.Instance), Err: errors.New("test " + a.Test.Name + " is not a job")}
+	}
+	workerID, err := d.workerID(ctx, a.Worker.Name, a.Worker.Instance)
+	if err == nil {
+		err = d.Client.Unassign(ctx, jobID, workerID)
+	}
+	if err != nil {
+		return &DispatchError{JobID: jobID, Worker: workerKey(a.Worker.Name, a.Worker.Instance), Err: err}
+	}
+	return nil
+}
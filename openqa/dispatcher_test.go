@@ -0,0 +1,286 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package openqa
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+	"github.com/mudler/openqa-scheduler-go/openqa/openqatest"
+	"github.com/mudler/openqa-scheduler-go/scheduler"
+)
+
+const (
+	testKey    = "1234567890ABCDEF"
+	testSecret = "FEDCBA0987654321"
+)
+
+func assignment(job int, host string) *decoder.Assignment {
+	return decoder.NewAssignment(&encoder.Test{Name: JobName(job)}, &encoder.Worker{Name: host, Instance: 1}, common.STATE_CURRENT, true)
+}
+
+func posts(srv *openqatest.Server) int {
+	n := 0
+	for _, r := range srv.Requests() {
+		if strings.HasPrefix(r, "POST ") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestHash(t *testing.T) {
+	if h := Hash("/api/v1/jobs/3/assign?worker_id=2", "1500000000.250000", "1234567890ABCDEF"); h != "477ec5b99ff2a70ddb7ac90ebd5cda04f8964281" {
+		t.Error("Wrong hash", h)
+	}
+}
+
+func TestDispatcherAuth(t *testing.T) {
+	srv := openqatest.NewServer()
+	defer srv.Close()
+	srv.AddKey(testKey, testSecret)
+	srv.AddWorker("openqaworker1", 1, "qemu_x86_64")
+	job := srv.AddJob("install", "qemu_x86_64")
+
+	for name, c := range map[string]*Client{
+		"unsigned":     NewClient(srv.URL),
+		"wrong key":    {URL: srv.URL, HTTP: http.DefaultClient, Key: "0000000000000000", Secret: testSecret},
+		"wrong secret": {URL: srv.URL, HTTP: http.DefaultClient, Key: testKey, Secret: "0000000000000000"},
+		"clock skew": {URL: srv.URL, HTTP: http.DefaultClient, Key: testKey, Secret: testSecret,
+			Now: func() time.Time { return time.Now().Add(-10 * time.Minute) }},
+	} {
+		err := NewDispatcher(c).Dispatch(context.Background(), assignment(job, "openqaworker1"))
+		var apiErr *Error
+		if !errors.As(err, &apiErr) || apiErr.Status != http.StatusForbidden {
+			t.Error(name, "client not refused", err)
+		}
+	}
+	if len(srv.Assignments()) != 0 {
+		t.Fatal("Unauthorized assignment", srv.Assignments())
+	}
+
+	c := NewClient(srv.URL)
+	c.Key, c.Secret = testKey, testSecret
+	if err := NewDispatcher(c).Dispatch(context.Background(), assignment(job, "openqaworker1")); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.Assignments()) != 1 || srv.Job(job).State != common.OPENQA_JOB_ASSIGNED {
+		t.Error("Job not assigned", srv.Job(job))
+	}
+}
+
+func TestDispatcherIdempotent(t *testing.T) {
+	srv := openqatest.NewServer()
+	defer srv.Close()
+	w1 := srv.AddWorker("openqaworker1", 1, "qemu_x86_64")
+	w2 := srv.AddWorker("openqaworker2", 1, "qemu_x86_64")
+	install := srv.AddJob("install", "qemu_x86_64")
+	boot := srv.AddJob("boot", "qemu_x86_64")
+
+	d := NewDispatcher(NewClient(srv.URL))
+	for i := 0; i < 2; i++ {
+		if err := d.Dispatch(context.Background(), assignment(install, "openqaworker1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if posts(srv) != 2 || len(srv.Assignments()) != 1 {
+		t.Error("Expected the assignment sent again and done once", srv.Requests())
+	}
+
+	// openQA put the job back to scheduled, it's assigned again
+	srv.Reschedule(install)
+	if err := d.Dispatch(context.Background(), assignment(install, "openqaworker1")); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.Assignments()) != 2 || srv.Job(install).State != common.OPENQA_JOB_ASSIGNED {
+		t.Error("Rescheduled job not assigned again", srv.Assignments())
+	}
+
+	// The job was assigned by a previous attempt whose answer was lost
+	srv.Assign(boot, w2)
+	srv.FailAssign = func(jobID, workerID int) error {
+		return &openqatest.Error{Status: http.StatusConflict, Message: "Job is assigned"}
+	}
+	if err := d.Dispatch(context.Background(), assignment(boot, "openqaworker2")); err != nil {
+		t.Error("Assignment already done not acknowledged", err)
+	}
+	if err := d.Dispatch(context.Background(), assignment(boot, "openqaworker1")); err == nil {
+		t.Error("Job assigned to another worker acknowledged")
+	}
+	if srv.Worker(w1).JobID != install || srv.Worker(w2).JobID != boot {
+		t.Error("Wrong assignments", srv.Assignments())
+	}
+}
+
+func TestDispatchErrors(t *testing.T) {
+	srv := openqatest.NewServer()
+	defer srv.Close()
+	srv.AddWorker("openqaworker1", 1, "qemu_x86_64")
+	srv.AddWorker("openqaworker2", 1, "qemu_x86_64")
+	install := srv.AddJob("install", "qemu_x86_64")
+	boot := srv.AddJob("boot", "qemu_x86_64")
+	srv.AddJob("gnome", "qemu_x86_64")
+
+	noJob := assignment(0, "openqaworker2")
+	noJob.Test.Name = "install"
+	d := NewDispatcher(NewClient(srv.URL))
+	ass := []*decoder.Assignment{
+		assignment(install, "openqaworker1"),
+		assignment(boot, "openqaworker1"),
+		assignment(3, "openqaworker3"),
+		noJob,
+		assignment(42, "openqaworker2"),
+	}
+	expected := []string{
+		"",
+		"Dispatch error: job 2 to worker openqaworker1:1: openQA error 409: Worker 1 is running",
+		"Dispatch error: job 3 to worker openqaworker3:1: unknown worker",
+		"Dispatch error: job 0 to worker openqaworker2:1: test install is not a job",
+		"Dispatch error: job 42 to worker openqaworker2:1: openQA error 404: Job 42 does not exist",
+	}
+	for i, a := range ass {
+		msg := ""
+		if err := d.Dispatch(context.Background(), a); err != nil {
+			msg = err.Error()
+		}
+		if msg != expected[i] {
+			t.Errorf("Assignment %d: expected %q, got %q", i, expected[i], msg)
+		}
+	}
+	if len(srv.Assignments()) != 1 {
+		t.Error("Wrong assignments", srv.Assignments())
+	}
+}
+
+func TestDispatcherRevoke(t *testing.T) {
+	srv := openqatest.NewServer()
+	defer srv.Close()
+	srv.AddWorker("openqaworker1", 1, "qemu_x86_64")
+	w2 := srv.AddWorker("openqaworker2", 1, "qemu_x86_64")
+	install := srv.AddJob("install", "qemu_x86_64")
+	boot := srv.AddJob("boot", "qemu_x86_64")
+
+	d := NewDispatcher(NewClient(srv.URL))
+	if err := d.Dispatch(context.Background(), assignment(install, "openqaworker1")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := d.Revoke(context.Background(), assignment(install, "openqaworker1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if srv.Job(install).State != common.OPENQA_JOB_SCHEDULED || srv.Worker(w2).JobID != 0 {
+		t.Error("Job not put back to scheduled", srv.Job(install))
+	}
+
+	// Jobs assigned to another worker or picked up are left alone
+	srv.Assign(boot, w2)
+	err := d.Revoke(context.Background(), assignment(boot, "openqaworker1"))
+	if err == nil || err.Error() != "Dispatch error: job 2 to worker openqaworker1:1: openQA error 409: Job 2 is assigned" {
+		t.Error("Job assigned to another worker revoked", err)
+	}
+	srv.Start(boot)
+	if err := d.Revoke(context.Background(), assignment(boot, "openqaworker2")); err == nil || srv.Job(boot).State != common.OPENQA_JOB_RUNNING {
+		t.Error("Running job revoked", srv.Job(boot))
+	}
+}
+
+func TestDispatcherLoopParallel(t *testing.T) {
+	srv := openqatest.NewServer()
+	defer srv.Close()
+	srv.AddWorker("openqaworker1", 1, "qemu_x86_64")
+	srv.AddWorker("openqaworker2", 1, "qemu_x86_64")
+	server := srv.AddJob("server", "qemu_x86_64")
+	client := srv.AddJob("client", "qemu_x86_64")
+	srv.Parallel(server, client)
+
+	// The server is dispatched first, then the client fails
+	failed := false
+	srv.FailAssign = func(jobID, workerID int) error {
+		if jobID == client && !failed {
+			failed = true
+			return errors.New("database locked")
+		}
+		return nil
+	}
+
+	c := NewClient(srv.URL)
+	l := scheduler.NewLoop(scheduler.NewScheduler(nil, nil), NewImporter(c), NewDispatcher(c))
+	res, err := l.Tick(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Committed) != 0 || len(res.Failed) != 2 || !failed {
+		t.Fatal("Expected the parallel cluster to fail as a whole", res.Committed, res.Failed)
+	}
+	if srv.Job(server).State != common.OPENQA_JOB_SCHEDULED || len(srv.Assignments()) != 1 {
+		t.Error("Dispatched server not revoked", srv.Job(server), srv.Assignments())
+	}
+
+	if res, err = l.Tick(context.Background()); err != nil || len(res.Committed) != 2 {
+		t.Fatal("Expected the parallel cluster assigned", res, err)
+	}
+	if srv.Job(server).State != common.OPENQA_JOB_ASSIGNED || srv.Job(client).State != common.OPENQA_JOB_ASSIGNED {
+		t.Error("Parallel cluster not assigned", srv.Job(server), srv.Job(client))
+	}
+}
+
+func TestDispatcherLoop(t *testing.T) {
+	srv := openqatest.NewServer()
+	defer srv.Close()
+	srv.AddKey(testKey, testSecret)
+	srv.AddWorker("openqaworker1", 1, "qemu_x86_64")
+	srv.AddWorker("openqaworker2", 1, "qemu_x86_64")
+	install := srv.AddJob("install", "qemu_x86_64")
+	boot := srv.AddJob("boot", "qemu_x86_64")
+
+	// The first assignment of install fails
+	failed := false
+	srv.FailAssign = func(jobID, workerID int) error {
+		if jobID == install && !failed {
+			failed = true
+			return errors.New("database locked")
+		}
+		return nil
+	}
+
+	c := NewClient(srv.URL)
+	c.Key, c.Secret = testKey, testSecret
+	l := scheduler.NewLoop(scheduler.NewScheduler(nil, nil), NewImporter(c), NewDispatcher(c))
+	l.Retries = 1
+	res, err := l.Tick(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Committed) != 2 || len(res.Failed) != 0 || !failed {
+		t.Fatal("Expected both jobs assigned after a retry", res.Failed)
+	}
+	if srv.Job(install).State != common.OPENQA_JOB_ASSIGNED || srv.Job(boot).State != common.OPENQA_JOB_ASSIGNED {
+		t.Error("Jobs not assigned", srv.Job(install), srv.Job(boot))
+	}
+
+	// Nothing left to do
+	if res, err = l.Tick(context.Background()); err != nil || len(res.Committed) != 0 || len(res.Failed) != 0 {
+		t.Error("Unexpected tick", res, err)
+	}
+}
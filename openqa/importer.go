@@ -0,0 +1,173 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package openqa
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+	"github.com/mudler/openqa-scheduler-go/scheduler"
+)
+
+// TimeLayout is the layout of the API timestamps, in UTC
+const TimeLayout = "2006-01-02T15:04:05"
+
+// Importer provides the workers and scheduled jobs of an openQA instance to
+// a scheduling loop. Workers are named after their host, jobs after their id.
+type Importer struct {
+	Client *Client
+}
+
+func NewImporter(c *Client) *Importer {
+	return &Importer{Client: c}
+}
+
+// ImportWorker returns the scheduler worker of w. Idle and running workers
+// are online, dead workers offline. The properties other than the worker
+// class are kept as worker properties.
+func ImportWorker(w *Worker) *encoder.Worker {
+	res := &encoder.Worker{Name: w.Host, Instance: w.Instance}
+	res.SetHost(w.Host)
+	switch w.Status {
+	case common.OPENQA_WORKER_DEAD:
+		res.SetStatus(common.WORKER_OFFLINE)
+	case common.OPENQA_WORKER_BROKEN:
+		res.SetStatus(common.WORKER_BROKEN)
+	default:
+		res.SetStatus(common.WORKER_ONLINE)
+	}
+	for k, v := range w.Properties {
+		if k == common.OPENQA_WORKER_CLASS {
+			for _, c := range strings.Split(v, ",") {
+				if c = strings.TrimSpace(c); c != "" {
+					res.AddWorkerClass(c)
+				}
+			}
+			continue
+		}
+		res.SetProperty(k, v)
+	}
+	return res
+}
+
+// JobName returns the name of the scheduler test of a job
+func JobName(id int) string {
+	return strconv.Itoa(id)
+}
+
+// ImportJob returns the scheduler test of j. openQA priorities grow less
+// urgent, the default one is priority 0. The test waits for its first
+// chained parent, Snapshot picks one not finished yet. Directly chained
+// parents are waited for as chained ones: the test may go to another worker
+// than its parent, and the worker may run other jobs in between.
+func ImportJob(j *Job) *encoder.Test {
+	t := &encoder.Test{Name: JobName(j.ID)}
+	for _, c := range strings.Split(j.Settings[common.OPENQA_WORKER_CLASS], ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			t.AddWorkerClass(c)
+		}
+	}
+	t.SetPriority(common.OPENQA_DEFAULT_PRIORITY - j.Priority)
+	t.SetGroup(j.Group)
+	if created, err := time.Parse(TimeLayout, j.Created); err == nil {
+		t.SetSubmitted(created)
+	}
+	if started, err := time.Parse(TimeLayout, j.Started); err == nil {
+		t.SetStarted(started)
+	}
+	if parents := jobParents(j); len(parents) > 0 {
+		t.SetParent(JobName(parents[0]))
+	}
+	for _, p := range append(append([]int{}, j.Parents.Parallel...), j.Children.Parallel...) {
+		t.AddParallel(JobName(p))
+	}
+	return t
+}
+
+// jobParents returns the chained and directly chained parents of j
+func jobParents(j *Job) []int {
+	return append(append([]int{}, j.Parents.Chained...), j.Parents.DirectlyChained...)
+}
+
+// Snapshot returns the workers, the scheduled jobs and the jobs running on
+// the workers. A scheduled job with several parents waits for one still
+// scheduled or running, and has no parent once all of them are done.
+// Parallel links to jobs neither scheduled nor running are dropped, they
+// can't be assigned anymore.
+func (i *Importer) Snapshot(ctx context.Context) (*scheduler.Snapshot, error) {
+	workers, err := i.Client.Workers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := i.Client.Jobs(ctx, common.OPENQA_JOB_SCHEDULED, common.OPENQA_JOB_ASSIGNED, common.OPENQA_JOB_RUNNING)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*Job)
+	for _, j := range jobs {
+		byID[j.ID] = j
+	}
+
+	snap := &scheduler.Snapshot{Workers: encoder.NewWorkerColl(), Tests: encoder.NewTestColl()}
+	known := make(map[string]bool)
+	for _, w := range workers {
+		imported := ImportWorker(w)
+		snap.Workers.AddWorker(imported)
+		if w.JobID != 0 {
+			// Running jobs count in the quotas of their group, the job may
+			// have finished since the workers were fetched though
+			t := &encoder.Test{Name: JobName(w.JobID)}
+			if j := byID[w.JobID]; j != nil {
+				t = ImportJob(j)
+				t.Parent, t.Parallel = "", nil
+			}
+			snap.Running = append(snap.Running, decoder.NewAssignment(t, imported, common.STATE_CURRENT, true))
+			known[t.Name] = true
+		}
+	}
+	for _, j := range jobs {
+		if j.State == common.OPENQA_JOB_SCHEDULED {
+			known[JobName(j.ID)] = true
+		}
+	}
+	for _, j := range jobs {
+		if j.State != common.OPENQA_JOB_SCHEDULED {
+			continue
+		}
+		t := ImportJob(j)
+		t.Parent = ""
+		for _, p := range jobParents(j) {
+			if known[JobName(p)] {
+				t.SetParent(JobName(p))
+				break
+			}
+		}
+		var peers []string
+		for _, p := range t.Parallel {
+			if known[p] {
+				peers = append(peers, p)
+			}
+		}
+		t.Parallel = peers
+		snap.Tests.AddTest(t)
+	}
+	return snap, nil
+}
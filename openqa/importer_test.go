@@ -0,0 +1,164 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package openqa
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/openqa/openqatest"
+	"github.com/mudler/openqa-scheduler-go/scheduler"
+)
+
+func TestImporter(t *testing.T) {
+	srv := openqatest.NewServer()
+	defer srv.Close()
+
+	w1 := srv.AddWorker("openqaworker1", 1, "qemu_x86_64", "tap")
+	srv.SetWorkerProperty(w1, "CPU_ARCH", "x86_64")
+	w2 := srv.AddWorker("openqaworker2", 1, "qemu_x86_64")
+	srv.SetWorkerStatus(srv.AddWorker("openqaworker3", 1, "qemu_x86_64"), common.OPENQA_WORKER_DEAD)
+
+	install := srv.AddJob("install", "qemu_x86_64")
+	boot := srv.AddJob("boot", "qemu_x86_64, tap")
+	srv.UpdateJob(boot, func(j *openqatest.Job) { j.Priority, j.Group = 40, "functional" })
+	srv.Chain(install, boot)
+	server := srv.AddJob("server", "qemu_x86_64")
+	client := srv.AddJob("client", "qemu_x86_64")
+	srv.Parallel(server, client)
+	srv.Parallel(server, srv.AddJob("done", "qemu_x86_64"))
+	srv.Finish(5, "passed")
+	// The first parent is done, the other one still scheduled
+	publish := srv.AddJob("publish", "qemu_x86_64")
+	srv.Chain(5, publish)
+	srv.UpdateJob(publish, func(j *openqatest.Job) { j.Parents.DirectlyChained = []int{boot} })
+	// All the parents are done
+	report := srv.AddJob("report", "qemu_x86_64")
+	srv.Chain(5, report)
+	srv.UpdateJob(install, func(j *openqatest.Job) { j.Group = "installation" })
+	if err := srv.Assign(install, w2); err != nil {
+		t.Fatal(err)
+	}
+	srv.Start(install)
+
+	snap, err := NewImporter(NewClient(srv.URL)).Snapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Workers.Workers) != 3 {
+		t.Fatal("Wrong workers", snap.Workers.Workers)
+	}
+	w := snap.Workers.FindWorker("openqaworker1", 1)
+	if w == nil || !w.ProvidesWorkerClass("tap", nil) || w.Properties["CPU_ARCH"] != "x86_64" || w.GetHost() != "openqaworker1" {
+		t.Error("Wrong worker", w)
+	}
+	if !snap.Workers.FindWorker("openqaworker3", 1).IsOffline() {
+		t.Error("Dead worker online")
+	}
+	if len(snap.Running) != 1 || snap.Running[0].Test.Name != "1" || snap.Running[0].Worker.Name != "openqaworker2" {
+		t.Fatal("Wrong running jobs", snap.Running)
+	}
+	if r := snap.Running[0].Test; r.Group != "installation" || len(r.WorkerClass) != 1 || r.Started.IsZero() {
+		t.Error("Expected the running job imported with its group, worker class and start", r)
+	}
+
+	if len(snap.Tests.Tests) != 5 {
+		t.Fatal("Wrong scheduled jobs", snap.Tests.Tests)
+	}
+	b := snap.Tests.FindTest(JobName(boot))
+	if b.Parent != "1" || b.Priority != 10 || b.Group != "functional" || len(b.WorkerClass) != 2 || b.Submitted.IsZero() {
+		t.Error("Wrong test", b)
+	}
+	if p := snap.Tests.FindTest(JobName(publish)); p.Parent != JobName(boot) {
+		t.Error("Expected the job waiting for its scheduled parent", p.Parent)
+	}
+	if r := snap.Tests.FindTest(JobName(report)); r.Parent != "" {
+		t.Error("Expected the job of done parents without parent", r.Parent)
+	}
+	s := snap.Tests.FindTest(JobName(server))
+	if len(s.Parallel) != 1 || s.Parallel[0] != JobName(client) {
+		t.Error("Expected the parallel link to the done job dropped", s.Parallel)
+	}
+
+	if _, err := NewImporter(NewClient(srv.URL + "/nowhere")).Snapshot(context.Background()); err == nil {
+		t.Error("Expected an error")
+	} else if e, ok := err.(*Error); !ok || e.Status != 404 {
+		t.Error("Expected a not found error", err)
+	}
+}
+
+// serverDispatcher assigns jobs directly on the server
+type serverDispatcher struct {
+	srv     *openqatest.Server
+	workers map[string]int
+}
+
+func (d *serverDispatcher) Dispatch(ctx context.Context, a *decoder.Assignment) error {
+	job, _ := strconv.Atoi(a.Test.Name)
+	return d.srv.Assign(job, d.workers[a.Worker.Name])
+}
+
+func TestImporterLoop(t *testing.T) {
+	srv := openqatest.NewServer()
+	defer srv.Close()
+
+	d := &serverDispatcher{srv: srv, workers: map[string]int{
+		"openqaworker1": srv.AddWorker("openqaworker1", 1, "qemu_x86_64"),
+		"openqaworker2": srv.AddWorker("openqaworker2", 1, "qemu_x86_64"),
+	}}
+	server := srv.AddJob("server", "qemu_x86_64")
+	srv.Parallel(server, srv.AddJob("client", "qemu_x86_64"))
+	install := srv.AddJob("install", "qemu_x86_64")
+	srv.Chain(install, srv.AddJob("boot", "qemu_x86_64"))
+
+	s := scheduler.NewScheduler(nil, nil)
+	s.AllowPending = true
+	l := scheduler.NewLoop(s, NewImporter(NewClient(srv.URL)), d)
+	tick := func() *scheduler.TickResult {
+		res, err := l.Tick(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	// The parallel cluster takes both workers
+	if res := tick(); len(res.Committed) != 2 || len(srv.Assignments()) != 2 {
+		t.Fatal("Expected the cluster assigned", res.Committed, res.Plan.Pending)
+	}
+	if res := tick(); len(res.Committed) != 0 {
+		t.Error("Busy workers assigned", res.Committed)
+	}
+	for _, a := range srv.Assignments() {
+		srv.Start(a.JobID)
+		srv.Finish(a.JobID, "passed")
+	}
+
+	// Then the chain, one after the other
+	if res := tick(); len(res.Committed) != 1 || res.Committed[0].Test.Name != JobName(install) {
+		t.Fatal("Expected the parent assigned", res.Committed)
+	}
+	srv.Finish(install, "passed")
+	if res := tick(); len(res.Committed) != 1 || len(res.Plan.Pending) != 0 {
+		t.Fatal("Expected the child assigned", res.Committed)
+	}
+	if len(srv.Assignments()) != 4 {
+		t.Error("Wrong assignments", srv.Assignments())
+	}
+}
@@ -0,0 +1,548 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+// Package openqatest provides a local stand-in of the openQA HTTP API for
+// tests: it serves workers and jobs, accepts assignments of jobs to workers,
+// and their revocation, and lets tests simulate jobs starting and finishing.
+package openqatest
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+)
+
+// Worker is a worker as served by the API
+type Worker struct {
+	ID         int               `json:"id"`
+	Host       string            `json:"host"`
+	Instance   int               `json:"instance"`
+	Status     string            `json:"status"`
+	JobID      int               `json:"jobid,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// Dependencies are the jobs a job depends on, or which depend on it
+type Dependencies struct {
+	Chained         []int `json:"Chained,omitempty"`
+	DirectlyChained []int `json:"Directly chained,omitempty"`
+	Parallel        []int `json:"Parallel,omitempty"`
+}
+
+// Job is a job as served by the API
+type Job struct {
+	ID               int               `json:"id"`
+	Name             string            `json:"name"`
+	State            string            `json:"state"`
+	Result           string            `json:"result,omitempty"`
+	Priority         int               `json:"priority"`
+	Group            string            `json:"group,omitempty"`
+	Created          string            `json:"t_created,omitempty"`
+	Started          string            `json:"t_started,omitempty"`
+	AssignedWorkerID int               `json:"assigned_worker_id,omitempty"`
+	Settings         map[string]string `json:"settings,omitempty"`
+	Parents          Dependencies      `json:"parents"`
+	Children         Dependencies      `json:"children"`
+}
+
+// Assignment records a job assigned to a worker through the API
+type Assignment struct {
+	JobID    int
+	WorkerID int
+}
+
+// Server is an openQA stand-in listening on a local port. Its URL is the
+// base of the API, e.g. srv.URL + "/api/v1/workers".
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	workers     map[int]*Worker
+	jobs        map[int]*Job
+	nextWorker  int
+	nextJob     int
+	assignments []Assignment
+	requests    []string
+	// keys maps the API keys to their secrets
+	keys map[string]string
+
+	// FailAssign, if set, is called before assigning a job through the API,
+	// an error fails the request, with a 500 unless it's an *Error
+	FailAssign func(jobID, workerID int) error
+	// Now returns the current time, time.Now if nil
+	Now func() time.Time
+}
+
+// NewServer starts a server without workers nor jobs, it must be closed
+func NewServer() *Server {
+	s := &Server{workers: make(map[int]*Worker), jobs: make(map[int]*Job)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// serve routes the requests, as "METHOD path" with the job id replaced by {id}
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+	s.mu.Unlock()
+
+	route, id := r.URL.Path, ""
+	if rest := strings.TrimPrefix(route, "/api/v1/jobs/"); rest != route {
+		parts := strings.SplitN(rest, "/", 2)
+		id, route = parts[0], "/api/v1/jobs/{id}"
+		if len(parts) == 2 {
+			route += "/" + parts[1]
+		}
+	}
+	if r.Method != http.MethodGet {
+		if err := s.authenticate(r); err != nil {
+			fail(w, err)
+			return
+		}
+	}
+	switch r.Method + " " + route {
+	case "GET /api/v1/workers":
+		s.listWorkers(w, r)
+	case "GET /api/v1/jobs":
+		s.listJobs(w, r)
+	case "GET /api/v1/jobs/{id}":
+		s.getJob(w, r, id)
+	case "POST /api/v1/jobs/{id}/assign":
+		s.assignJob(w, r, id)
+	case "POST /api/v1/jobs/{id}/unassign":
+		s.unassignJob(w, r, id)
+	case "POST /api/v1/jobs/{id}/set_done":
+		s.setDone(w, r, id)
+	default:
+		fail(w, &Error{http.StatusNotFound, "Not found: " + r.Method + " " + r.URL.Path})
+	}
+}
+
+// AddWorker adds an idle worker providing classes, and returns its id
+func (s *Server) AddWorker(host string, instance int, classes ...string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextWorker++
+	s.workers[s.nextWorker] = &Worker{
+		ID: s.nextWorker, Host: host, Instance: instance, Status: common.OPENQA_WORKER_IDLE,
+		Properties: map[string]string{common.OPENQA_WORKER_CLASS: strings.Join(classes, ",")},
+	}
+	return s.nextWorker
+}
+
+// SetWorkerStatus changes the status of a worker, e.g. to dead or broken
+func (s *Server) SetWorkerStatus(id int, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workers[id].Status = status
+}
+
+// SetWorkerProperty sets a property the worker advertises
+func (s *Server) SetWorkerProperty(id int, key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workers[id].Properties[key] = value
+}
+
+// AddJob schedules a job of the default priority requiring classes, and
+// returns its id
+func (s *Server) AddJob(name string, classes ...string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextJob++
+	s.jobs[s.nextJob] = &Job{
+		ID: s.nextJob, Name: name, State: common.OPENQA_JOB_SCHEDULED, Priority: common.OPENQA_DEFAULT_PRIORITY,
+		Created:  time.Now().UTC().Format("2006-01-02T15:04:05"),
+		Settings: map[string]string{common.OPENQA_WORKER_CLASS: strings.Join(classes, ",")},
+	}
+	return s.nextJob
+}
+
+// UpdateJob changes a job, e.g. its priority or group
+func (s *Server) UpdateJob(id int, update func(j *Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(s.jobs[id])
+}
+
+// Chain makes child wait for parent to finish
+func (s *Server) Chain(parent, child int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[child].Parents.Chained = append(s.jobs[child].Parents.Chained, parent)
+	s.jobs[parent].Children.Chained = append(s.jobs[parent].Children.Chained, child)
+}
+
+// Parallel makes child run along with parent
+func (s *Server) Parallel(parent, child int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[child].Parents.Parallel = append(s.jobs[child].Parents.Parallel, parent)
+	s.jobs[parent].Children.Parallel = append(s.jobs[parent].Children.Parallel, child)
+}
+
+// Job returns a copy of the job, or nil if unknown
+func (s *Server) Job(id int) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		c := *j
+		return &c
+	}
+	return nil
+}
+
+// Worker returns a copy of the worker, or nil if unknown
+func (s *Server) Worker(id int) *Worker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w, ok := s.workers[id]; ok {
+		c := *w
+		return &c
+	}
+	return nil
+}
+
+// Assignments returns the assignments accepted so far
+func (s *Server) Assignments() []Assignment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Assignment{}, s.assignments...)
+}
+
+// Requests returns the requests served so far, as "METHOD path"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// Assign assigns a scheduled job to an idle worker, as the API does
+func (s *Server) Assign(jobID, workerID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.assign(jobID, workerID)
+	return err
+}
+
+// Start sets an assigned job running from now
+func (s *Server) Start(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok || j.State != common.OPENQA_JOB_ASSIGNED {
+		return fmt.Errorf("job %d is not assigned", id)
+	}
+	j.State, j.Started = common.OPENQA_JOB_RUNNING, time.Now().UTC().Format("2006-01-02T15:04:05")
+	return nil
+}
+
+// Reschedule puts an assigned job back to scheduled and frees its worker,
+// as openQA does when the worker doesn't pick the job up
+func (s *Server) Reschedule(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok || j.State != common.OPENQA_JOB_ASSIGNED {
+		return fmt.Errorf("job %d is not assigned", id)
+	}
+	s.reschedule(j)
+	return nil
+}
+
+func (s *Server) reschedule(j *Job) {
+	if w, ok := s.workers[j.AssignedWorkerID]; ok && w.JobID == j.ID {
+		w.Status, w.JobID = common.OPENQA_WORKER_IDLE, 0
+	}
+	j.State, j.AssignedWorkerID = common.OPENQA_JOB_SCHEDULED, 0
+}
+
+// Finish sets a job done with result, and frees its worker
+func (s *Server) Finish(id int, result string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.finish(id, result)
+}
+
+func (s *Server) finish(id int, result string) error {
+	j, ok := s.jobs[id]
+	if !ok {
+		return fmt.Errorf("job %d does not exist", id)
+	}
+	if w, ok := s.workers[j.AssignedWorkerID]; ok && w.JobID == id {
+		w.JobID = 0
+		if w.Status == common.OPENQA_WORKER_RUNNING {
+			w.Status = common.OPENQA_WORKER_IDLE
+		}
+	}
+	j.State, j.Result = common.OPENQA_JOB_DONE, result
+	return nil
+}
+
+// AddKey adds an API key. Once a key is added, the requests changing jobs
+// must be signed with one.
+func (s *Server) AddKey(key, secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		s.keys = make(map[string]string)
+	}
+	s.keys[key] = secret
+}
+
+// authenticate checks the signature of r, the hex HMAC-SHA1 by the secret
+// of the key of the path, the unescaped query and the timestamp
+func (s *Server) authenticate(r *http.Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.keys) == 0 {
+		return nil
+	}
+	key := r.Header.Get(common.OPENQA_HEADER_KEY)
+	if key == "" {
+		return &Error{http.StatusForbidden, "Not authorized: no API key"}
+	}
+	secret, ok := s.keys[key]
+	if !ok {
+		return &Error{http.StatusForbidden, "Not authorized: unknown API key"}
+	}
+	microtime := r.Header.Get(common.OPENQA_HEADER_MICROTIME)
+	ts, err := strconv.ParseFloat(microtime, 64)
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	if err != nil || math.Abs(float64(now().UnixNano())/1e9-ts) > common.OPENQA_MAX_CLOCK_SKEW {
+		return &Error{http.StatusForbidden, "Not authorized: timestamp mismatch"}
+	}
+	pathQuery := r.URL.Path
+	if r.URL.RawQuery != "" {
+		query, err := url.QueryUnescape(r.URL.RawQuery)
+		if err != nil {
+			return &Error{http.StatusBadRequest, "Invalid query"}
+		}
+		pathQuery += "?" + query
+	}
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(pathQuery + microtime))
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(r.Header.Get(common.OPENQA_HEADER_HASH))) {
+		return &Error{http.StatusForbidden, "Not authorized: hash mismatch"}
+	}
+	return nil
+}
+
+// Error is an error answered with its HTTP status
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// assign assigns the job, assigning it again to the same worker is a no-op
+func (s *Server) assign(jobID, workerID int) (bool, error) {
+	j, ok := s.jobs[jobID]
+	if !ok {
+		return false, &Error{http.StatusNotFound, fmt.Sprintf("Job %d does not exist", jobID)}
+	}
+	w, ok := s.workers[workerID]
+	if !ok {
+		return false, &Error{http.StatusNotFound, fmt.Sprintf("Worker %d does not exist", workerID)}
+	}
+	if j.AssignedWorkerID == workerID && w.JobID == jobID {
+		return false, nil
+	}
+	if j.State != common.OPENQA_JOB_SCHEDULED {
+		return false, &Error{http.StatusConflict, fmt.Sprintf("Job %d is %s", jobID, j.State)}
+	}
+	if w.Status != common.OPENQA_WORKER_IDLE {
+		return false, &Error{http.StatusConflict, fmt.Sprintf("Worker %d is %s", workerID, w.Status)}
+	}
+	j.State, j.AssignedWorkerID = common.OPENQA_JOB_ASSIGNED, workerID
+	w.Status, w.JobID = common.OPENQA_WORKER_RUNNING, jobID
+	s.assignments = append(s.assignments, Assignment{JobID: jobID, WorkerID: workerID})
+	return true, nil
+}
+
+func reply(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// fail answers the error as openQA does
+func fail(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if e, ok := err.(*Error); ok {
+		status = e.Status
+	}
+	reply(w, status, map[string]interface{}{"error": err.Error(), "error_status": status})
+}
+
+func parseID(value string) (int, error) {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &Error{http.StatusBadRequest, "Invalid id " + value}
+	}
+	return id, nil
+}
+
+func (s *Server) listWorkers(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*Worker, 0, len(s.workers))
+	for _, wk := range s.workers {
+		list = append(list, wk)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	reply(w, http.StatusOK, map[string]interface{}{"workers": list})
+}
+
+// listJobs serves the jobs, filtered by the comma separated states of the
+// state parameter if given
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	states := make(map[string]bool)
+	if st := r.URL.Query().Get("state"); st != "" {
+		for _, state := range strings.Split(st, ",") {
+			states[state] = true
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		if len(states) == 0 || states[j.State] {
+			list = append(list, j)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	reply(w, http.StatusOK, map[string]interface{}{"jobs": list})
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request, value string) {
+	id, err := parseID(value)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		fail(w, &Error{http.StatusNotFound, fmt.Sprintf("Job %d does not exist", id)})
+		return
+	}
+	reply(w, http.StatusOK, map[string]interface{}{"job": j})
+}
+
+// assignJob assigns the job to the worker of the worker_id parameter. It
+// answers 200 if the job is assigned or was already assigned to the worker,
+// 404 for unknown jobs or workers and 409 if the job or worker is busy.
+func (s *Server) assignJob(w http.ResponseWriter, r *http.Request, value string) {
+	jobID, err := parseID(value)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	workerID, err := parseID(r.FormValue("worker_id"))
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	if s.FailAssign != nil {
+		if err := s.FailAssign(jobID, workerID); err != nil {
+			fail(w, err)
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assigned, err := s.assign(jobID, workerID)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	reply(w, http.StatusOK, map[string]interface{}{"job_id": jobID, "worker_id": workerID, "assigned": assigned})
+}
+
+// unassignJob puts the job assigned to the worker of the worker_id parameter
+// back to scheduled. It answers 200 if the job was assigned to the worker or
+// is scheduled already, 404 for unknown jobs and 409 if the job is assigned
+// to another worker or was picked up.
+func (s *Server) unassignJob(w http.ResponseWriter, r *http.Request, value string) {
+	jobID, err := parseID(value)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	workerID, err := parseID(r.FormValue("worker_id"))
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[jobID]
+	if !ok {
+		fail(w, &Error{http.StatusNotFound, fmt.Sprintf("Job %d does not exist", jobID)})
+		return
+	}
+	unassigned := false
+	switch {
+	case j.State == common.OPENQA_JOB_SCHEDULED:
+	case j.State == common.OPENQA_JOB_ASSIGNED && j.AssignedWorkerID == workerID:
+		s.reschedule(j)
+		unassigned = true
+	default:
+		fail(w, &Error{http.StatusConflict, fmt.Sprintf("Job %d is %s", jobID, j.State)})
+		return
+	}
+	reply(w, http.StatusOK, map[string]interface{}{"job_id": jobID, "worker_id": workerID, "unassigned": unassigned})
+}
+
+func (s *Server) setDone(w http.ResponseWriter, r *http.Request, value string) {
+	id, err := parseID(value)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	result := r.FormValue("result")
+	if result == "" {
+		result = "passed"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[id]; !ok {
+		fail(w, &Error{http.StatusNotFound, fmt.Sprintf("Job %d does not exist", id)})
+		return
+	}
+	s.finish(id, result)
+	reply(w, http.StatusOK, map[string]interface{}{"result": result})
+}
@@ -0,0 +1,147 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package openqatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+)
+
+func get(t *testing.T, srv *Server, path string, v interface{}) {
+	resp, err := srv.Client().Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("GET", path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func post(t *testing.T, srv *Server, path string, form url.Values) int {
+	resp, err := srv.Client().PostForm(srv.URL+path, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestServer(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	w1 := srv.AddWorker("openqaworker1", 1, "qemu_x86_64", "tap")
+	w2 := srv.AddWorker("openqaworker1", 2, "qemu_x86_64")
+	install := srv.AddJob("install", "qemu_x86_64")
+	boot := srv.AddJob("boot", "qemu_x86_64")
+	srv.Chain(install, boot)
+
+	var workers struct{ Workers []*Worker }
+	get(t, srv, "/api/v1/workers", &workers)
+	if len(workers.Workers) != 2 || workers.Workers[0].Properties[common.OPENQA_WORKER_CLASS] != "qemu_x86_64,tap" {
+		t.Fatal("Wrong workers", workers.Workers)
+	}
+
+	assign := func(job, worker string) int {
+		return post(t, srv, "/api/v1/jobs/"+job+"/assign", url.Values{"worker_id": {worker}})
+	}
+	if status := assign("1", "1"); status != http.StatusOK {
+		t.Fatal("Assignment refused", status)
+	}
+	if status := assign("1", "1"); status != http.StatusOK || len(srv.Assignments()) != 1 {
+		t.Error("Assigning again to the same worker not idempotent", status, srv.Assignments())
+	}
+	for _, c := range []struct {
+		job, worker string
+		status      int
+	}{
+		{"1", "2", http.StatusConflict},
+		{"2", "1", http.StatusConflict},
+		{"3", "2", http.StatusNotFound},
+		{"2", "3", http.StatusNotFound},
+		{"2", "two", http.StatusBadRequest},
+	} {
+		if status := assign(c.job, c.worker); status != c.status {
+			t.Error("Assigning job", c.job, "to worker", c.worker, "answered", status, "expected", c.status)
+		}
+	}
+
+	var jobs struct{ Jobs []*Job }
+	get(t, srv, "/api/v1/jobs?state=scheduled", &jobs)
+	if len(jobs.Jobs) != 1 || jobs.Jobs[0].ID != boot || jobs.Jobs[0].Parents.Chained[0] != install {
+		t.Error("Wrong scheduled jobs", jobs.Jobs)
+	}
+	if srv.Worker(w1).JobID != install || srv.Job(install).State != common.OPENQA_JOB_ASSIGNED {
+		t.Error("Job not assigned", srv.Worker(w1), srv.Job(install))
+	}
+
+	if err := srv.Reschedule(install); err != nil || srv.Worker(w1).JobID != 0 || srv.Job(install).State != common.OPENQA_JOB_SCHEDULED {
+		t.Error("Job not rescheduled", err, srv.Job(install))
+	}
+	if err := srv.Assign(install, w1); err != nil || srv.Reschedule(boot) == nil {
+		t.Error("Wrong reschedules", err)
+	}
+	unassign := func(job, worker string) int {
+		return post(t, srv, "/api/v1/jobs/"+job+"/unassign", url.Values{"worker_id": {worker}})
+	}
+	for _, c := range []struct {
+		job, worker string
+		status      int
+	}{
+		{"1", "2", http.StatusConflict},
+		{"1", "1", http.StatusOK},
+		{"1", "1", http.StatusOK},
+		{"3", "1", http.StatusNotFound},
+	} {
+		if status := unassign(c.job, c.worker); status != c.status {
+			t.Error("Unassigning job", c.job, "from worker", c.worker, "answered", status, "expected", c.status)
+		}
+	}
+	if srv.Worker(w1).JobID != 0 || srv.Job(install).State != common.OPENQA_JOB_SCHEDULED {
+		t.Error("Job not unassigned", srv.Worker(w1), srv.Job(install))
+	}
+	if err := srv.Assign(install, w1); err != nil {
+		t.Error("Wrong reschedules", err)
+	}
+
+	if err := srv.Start(install); err != nil || srv.Start(boot) == nil {
+		t.Error("Wrong starts", err)
+	}
+	if status := post(t, srv, "/api/v1/jobs/1/set_done", url.Values{"result": {"failed"}}); status != http.StatusOK {
+		t.Fatal("Job not set done", status)
+	}
+	var job struct{ Job *Job }
+	get(t, srv, "/api/v1/jobs/1", &job)
+	if job.Job.State != common.OPENQA_JOB_DONE || job.Job.Result != "failed" || srv.Worker(w1).Status != common.OPENQA_WORKER_IDLE {
+		t.Error("Job not done", job.Job, srv.Worker(w1))
+	}
+
+	srv.SetWorkerStatus(w2, common.OPENQA_WORKER_DEAD)
+	if err := srv.Assign(boot, w2); err == nil {
+		t.Error("Job assigned to a dead worker")
+	}
+	if len(srv.Requests()) != 15 || srv.Requests()[0] != "GET /api/v1/workers" {
+		t.Error("Wrong requests", srv.Requests())
+	}
+}
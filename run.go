@@ -0,0 +1,97 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/encoder"
+	"github.com/mudler/openqa-scheduler-go/openqa"
+	"github.com/mudler/openqa-scheduler-go/scheduler"
+)
+
+// printTick prints the assignments dispatched and failed by a tick
+func printTick(res *scheduler.TickResult, err error) {
+	if res != nil {
+		for _, a := range res.Committed {
+			fmt.Println("Job:", a.Test.Name, "Assigned to worker:", a.Worker.Encode())
+		}
+		for _, f := range res.Failed {
+			fmt.Fprintln(os.Stderr, "Error", f.Err, "after", f.Attempts, "attempts")
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error", err)
+	}
+}
+
+// runCommand schedules the jobs of an openQA instance and assigns them to
+// its workers through the API, once or on an interval until interrupted
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	key := flags.String("key", "", "openQA API key")
+	secret := flags.String("secret", "", "openQA API secret")
+	interval := flags.Duration("interval", 30*time.Second, "time between schedules")
+	once := flags.Bool("once", false, "schedule once and exit")
+	retries := flags.Int("retries", 2, "retries of a failed assignment")
+	solveTimeout := flags.Duration("solve-timeout", 10*time.Second, "time searching for the best schedule, 0 for no limit")
+	classes := flags.String("classes", "", "worker class registry file")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: openqa-scheduler-go run [-once] [-interval d] [-solve-timeout d] [-classes file] -key key -secret secret http://openqa")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	c := openqa.NewClient(flags.Arg(0))
+	c.Key, c.Secret = *key, *secret
+	s := scheduler.NewScheduler(nil, nil)
+	s.AllowPending = true
+	s.SolveTimeout = *solveTimeout
+	if *classes != "" {
+		var err error
+		if s.Classes, err = encoder.LoadClassRegistry(*classes); err != nil {
+			fmt.Fprintln(os.Stderr, "Error", err)
+			return 1
+		}
+	}
+	l := scheduler.NewLoop(s, openqa.NewImporter(c), openqa.NewDispatcher(c))
+	l.Interval = *interval
+	l.Retries = *retries
+	l.RetryDelay = time.Second
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *once {
+		res, err := l.Tick(ctx)
+		printTick(res, err)
+		if err != nil || len(res.Failed) > 0 {
+			return 1
+		}
+		return 0
+	}
+	l.OnTick = printTick
+	l.Run(ctx)
+	return 0
+}
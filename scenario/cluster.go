@@ -0,0 +1,130 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scenario
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// Size describes a generated openQA cluster
+type Size struct {
+	Workers int
+	Tests   int
+	// InstancesPerHost is how many worker instances run on each host
+	InstancesPerHost int
+	// MultiMachine is the ratio of tests belonging to parallel clusters
+	MultiMachine float64
+}
+
+// MultiMachineClass is the worker class of the workers able to run
+// multi-machine clusters
+const MultiMachineClass = "tap"
+
+// clusterClasses are the worker classes of a cluster, by weight
+var clusterClasses = []struct {
+	class  string
+	weight int
+}{
+	{"qemu_x86_64", 60},
+	{"qemu_aarch64", 15},
+	{"qemu_ppc64le", 10},
+	{"s390x-kvm", 10},
+	{"64bit-ipmi", 5},
+}
+
+func clusterClass(r *rand.Rand) string {
+	total := 0
+	for _, c := range clusterClasses {
+		total += c.weight
+	}
+	n := r.Intn(total)
+	for _, c := range clusterClasses {
+		if n < c.weight {
+			return c.class
+		}
+		n -= c.weight
+	}
+	return clusterClasses[0].class
+}
+
+// Cluster returns a scenario shaped like an openQA instance: hosts running
+// several worker instances of the same classes, a part of them able to run
+// multi-machine tests, and a queue of tests of mixed classes where some are
+// clusters of 2 or 3 parallel tests. It has no expectations, and allows
+// pending tests, as there are usually more tests than workers.
+func Cluster(r *rand.Rand, size Size) *Scenario {
+	sc := &Scenario{Name: fmt.Sprintf("cluster-%dw-%dt", size.Workers, size.Tests)}
+	sc.Config.AllowPending = true
+
+	perHost := size.InstancesPerHost
+	if perHost <= 0 {
+		perHost = 8
+	}
+	var class string
+	tap := false
+	for i := 0; i < size.Workers; i++ {
+		host := fmt.Sprintf("openqaworker%d", i/perHost+1)
+		if i == 0 {
+			// There is always an x86_64 host able to run multi-machine tests
+			class, tap = "qemu_x86_64", true
+		} else if i%perHost == 0 {
+			class = clusterClass(r)
+			tap = class == "qemu_x86_64" && r.Intn(2) == 0
+		}
+		w := &encoder.Worker{Name: host, Instance: i%perHost + 1}
+		w.AddWorkerClass(class)
+		if tap {
+			w.AddWorkerClass(MultiMachineClass)
+		}
+		w.SetHost(host)
+		sc.Workers = append(sc.Workers, w)
+	}
+
+	for len(sc.Tests) < size.Tests {
+		n := len(sc.Tests)
+		if r.Float64() >= size.MultiMachine || size.Tests-n < 2 {
+			t := &encoder.Test{Name: fmt.Sprintf("job%d", n+1)}
+			t.AddWorkerClass(clusterClass(r))
+			t.SetPriority(r.Intn(5) * 10)
+			sc.Tests = append(sc.Tests, t)
+			continue
+		}
+
+		peers := 2 + r.Intn(2)
+		if size.Tests-n < peers {
+			peers = size.Tests - n
+		}
+		var cluster []*encoder.Test
+		for j := 0; j < peers; j++ {
+			t := &encoder.Test{Name: fmt.Sprintf("job%d", n+j+1)}
+			t.AddWorkerClass("qemu_x86_64")
+			t.AddWorkerClass(MultiMachineClass)
+			cluster = append(cluster, t)
+		}
+		for _, t := range cluster {
+			for _, p := range cluster {
+				if p != t {
+					t.AddParallel(p.Name)
+				}
+			}
+		}
+		sc.Tests = append(sc.Tests, cluster...)
+	}
+	return sc
+}
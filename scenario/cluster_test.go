@@ -0,0 +1,178 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scenario
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/scheduler"
+)
+
+func TestCluster(t *testing.T) {
+	sc := Cluster(rand.New(rand.NewSource(1)), Size{Workers: 40, Tests: 100, MultiMachine: 0.3})
+	if len(sc.Workers) != 40 || len(sc.Tests) != 100 {
+		t.Fatal("Wrong cluster size", len(sc.Workers), len(sc.Tests))
+	}
+
+	hosts := make(map[string]int)
+	for _, w := range sc.Workers {
+		hosts[w.GetHost()]++
+	}
+	if len(hosts) != 5 {
+		t.Error("Expected 5 hosts of 8 instances", hosts)
+	}
+
+	_, tests := sc.Collections()
+	parallel := 0
+	for _, test := range sc.Tests {
+		if len(test.Parallel) == 0 {
+			continue
+		}
+		parallel++
+		if !test.RequiresWorkerClass(MultiMachineClass, nil) {
+			t.Error("Multi-machine test not requiring", MultiMachineClass, test)
+		}
+		for _, p := range test.Parallel {
+			peer := tests.FindTest(p)
+			if peer == nil || len(peer.Parallel) != len(test.Parallel) {
+				t.Error("Incomplete cluster", test.Name, p)
+			}
+		}
+	}
+	if parallel == 0 || parallel == len(sc.Tests) {
+		t.Error("Expected some multi-machine tests", parallel)
+	}
+
+	if _, err := sc.Scheduler(); err != nil {
+		t.Error(err)
+	}
+}
+
+var large = flag.Bool("large", false, "also benchmark the clusters at openQA scale")
+
+// benchSizes are the cluster sizes of the benchmarks. The formula grows with
+// the square of the tests, larger clusters are left to cmd/scheduler-bench.
+var benchSizes = []Size{
+	{Workers: 10, Tests: 20, MultiMachine: 0.2},
+	{Workers: 25, Tests: 50, MultiMachine: 0.2},
+	{Workers: 50, Tests: 100, MultiMachine: 0.2},
+}
+
+// largeSizes are clusters at openQA scale, hundreds of workers and thousands
+// of tests, only benchmarked with -large: each formula takes minutes and
+// gigabytes of memory.
+var largeSizes = []Size{
+	{Workers: 200, Tests: 1000, MultiMachine: 0.2},
+	{Workers: 500, Tests: 2000, MultiMachine: 0.2},
+}
+
+// planTimeout bounds the search for the cheapest plans of the benchmarks
+const planTimeout = time.Minute
+
+// BenchmarkBuildFormula reports the time to build the formulas, and their
+// variables and clauses
+func BenchmarkBuildFormula(b *testing.B) {
+	sizes := benchSizes
+	if *large {
+		sizes = append(append([]Size{}, sizes...), largeSizes...)
+	}
+	for _, size := range sizes {
+		sc := Cluster(rand.New(rand.NewSource(1)), size)
+		b.Run(fmt.Sprintf("%dw-%dt", size.Workers, size.Tests), func(b *testing.B) {
+			b.ReportAllocs()
+			var stats *scheduler.SolverStats
+			for i := 0; i < b.N; i++ {
+				s, err := sc.Scheduler()
+				if err != nil {
+					b.Fatal(err)
+				}
+				f := s.BuildFormula()
+				b.StopTimer()
+				if stats, err = scheduler.FormulaStats(f); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(stats.Variables), "vars")
+			b.ReportMetric(float64(stats.Clauses), "clauses")
+		})
+	}
+}
+
+func BenchmarkFormulaStats(b *testing.B) {
+	for _, size := range benchSizes {
+		sc := Cluster(rand.New(rand.NewSource(1)), size)
+		s, err := sc.Scheduler()
+		if err != nil {
+			b.Fatal(err)
+		}
+		f := s.BuildFormula()
+		b.Run(fmt.Sprintf("%dw-%dt", size.Workers, size.Tests), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := scheduler.FormulaStats(f); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkPlan solves clusters with as many tests as workers, and with more
+// tests than workers, where the solver has to find the cheapest tests to
+// leave pending. The plans have a solve timeout, the optimal metric tells
+// whether they were solved to the end.
+func BenchmarkPlan(b *testing.B) {
+	sizes := []Size{
+		{Workers: 10, Tests: 10, MultiMachine: 0.2},
+		{Workers: 20, Tests: 20, MultiMachine: 0.2},
+		{Workers: 10, Tests: 12, MultiMachine: 0.2},
+		{Workers: 10, Tests: 20, MultiMachine: 0.2},
+		{Workers: 20, Tests: 40, MultiMachine: 0.2},
+	}
+	if *large {
+		sizes = append(sizes, largeSizes...)
+	}
+	for _, size := range sizes {
+		sc := Cluster(rand.New(rand.NewSource(1)), size)
+		b.Run(fmt.Sprintf("%dw-%dt", size.Workers, size.Tests), func(b *testing.B) {
+			b.ReportAllocs()
+			var res *scheduler.ScheduleResult
+			for i := 0; i < b.N; i++ {
+				s, err := sc.Scheduler()
+				if err != nil {
+					b.Fatal(err)
+				}
+				s.SolveTimeout = planTimeout
+				if res, err = s.Plan(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			optimal := 0
+			if res.Stats.Optimal {
+				optimal = 1
+			}
+			b.ReportMetric(float64(res.Stats.Clauses), "clauses")
+			b.ReportMetric(float64(res.Stats.Solves), "solves")
+			b.ReportMetric(float64(res.Stats.Conflicts), "conflicts")
+			b.ReportMetric(float64(optimal), "optimal")
+		})
+	}
+}
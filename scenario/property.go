@@ -0,0 +1,381 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scenario
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+var (
+	genClasses  = []string{"qemu64", "qemu32", "64bit-ipmi"}
+	genHosts    = []string{"openqaworker1", "openqaworker2", "openqaworker3"}
+	genStatuses = []string{common.WORKER_ONLINE, common.WORKER_ONLINE, common.WORKER_ONLINE, common.WORKER_DRAINING, common.WORKER_OFFLINE}
+	genPolicies = []string{common.HOST_POLICY_ANY, common.HOST_POLICY_SAME, common.HOST_POLICY_SPREAD}
+	genGroups   = []string{"sle", "tumbleweed"}
+)
+
+// Generate returns a random scenario, without expectations, of a few
+// workers and tests with parallel clusters, parents, running tests, host
+// capacities and job group quotas. Capacities and quotas don't depend on the
+// running tests, they can be below them.
+func Generate(r *rand.Rand) *Scenario {
+	sc := &Scenario{Name: "generated"}
+	sc.Config.AllowPending = r.Intn(4) != 0
+
+	for i := 1; i <= 1+r.Intn(5); i++ {
+		w := &encoder.Worker{Name: fmt.Sprintf("w%d", i), Instance: 1}
+		w.AddWorkerClass(genClasses[r.Intn(len(genClasses))])
+		if r.Intn(2) == 0 {
+			w.AddWorkerClass(genClasses[r.Intn(len(genClasses))])
+		}
+		w.SetHost(genHosts[r.Intn(len(genHosts))])
+		w.SetStatus(genStatuses[r.Intn(len(genStatuses))])
+		sc.Workers = append(sc.Workers, w)
+	}
+
+	for i := 1; i <= 1+r.Intn(6); i++ {
+		t := &encoder.Test{Name: fmt.Sprintf("t%d", i)}
+		t.AddWorkerClass(genClasses[r.Intn(len(genClasses))])
+		t.SetPriority(r.Intn(3) * 10)
+		t.SetGroup(genGroups[r.Intn(len(genGroups))])
+		sc.Tests = append(sc.Tests, t)
+	}
+
+	// Running tests, on distinct workers
+	for _, i := range r.Perm(len(sc.Workers))[:r.Intn(len(sc.Workers)+1)] {
+		if r.Intn(2) == 0 {
+			continue
+		}
+		w := sc.Workers[i]
+		t := &encoder.Test{Name: fmt.Sprintf("r%d", len(sc.Running)+1), WorkerClass: w.WorkerClass[:1]}
+		t.SetGroup(genGroups[r.Intn(len(genGroups))])
+		sc.Running = append(sc.Running, t)
+		sc.InitialState = append(sc.InitialState, &Assignment{Test: t.Name, Worker: w.Name, Instance: w.Instance})
+	}
+
+	for i, t := range sc.Tests {
+		switch r.Intn(6) {
+		case 0:
+			peer := sc.Tests[r.Intn(len(sc.Tests))]
+			if peer != t && len(peer.Parallel) == 0 && len(t.Parallel) == 0 {
+				t.AddParallel(peer.Name)
+				peer.AddParallel(t.Name)
+				policy := genPolicies[r.Intn(len(genPolicies))]
+				t.SetHostPolicy(policy)
+				peer.SetHostPolicy(policy)
+			}
+		case 1:
+			// Parents come first, so that they never cycle
+			if i > 0 {
+				t.SetParent(sc.Tests[r.Intn(i)].Name)
+			}
+		case 2:
+			if len(sc.Running) > 0 {
+				t.SetParent(sc.Running[r.Intn(len(sc.Running))].Name)
+			}
+		}
+	}
+
+	for _, h := range genHosts {
+		if r.Intn(3) == 0 {
+			if sc.Config.HostCapacity == nil {
+				sc.Config.HostCapacity = make(map[string]int)
+			}
+			sc.Config.HostCapacity[h] = r.Intn(3)
+		}
+	}
+	for _, g := range genGroups {
+		if r.Intn(3) == 0 {
+			if sc.Config.GroupQuota == nil {
+				sc.Config.GroupQuota = make(map[string]int)
+			}
+			sc.Config.GroupQuota[g] = r.Intn(3)
+		}
+	}
+	return sc
+}
+
+func findWorker(sc *Scenario, name string, instance int) *encoder.Worker {
+	for _, w := range sc.Workers {
+		if w.Name == name && w.Instance == instance {
+			return w
+		}
+	}
+	return nil
+}
+
+// CheckInvariants schedules the scenario and checks the properties every
+// schedule must have:
+//   - pending tests never make the schedule fail
+//   - every worker runs at most one test
+//   - hosts and job groups only get new tests up to their capacity and quota,
+//     the running tests count but can be over them
+//   - tests are assigned once, to online workers providing their class
+//   - parallel clusters are assigned as a whole
+//   - tests never start while their parent is queued or running
+//   - running tests are kept, unless their worker went offline
+func (sc *Scenario) CheckInvariants() error {
+	s, err := sc.Scheduler()
+	if err != nil {
+		return err
+	}
+	queued := make(map[string]bool)
+	for _, t := range sc.Tests {
+		queued[t.Name] = true
+	}
+
+	ass, err := s.ScheduleDecode()
+	if err != nil {
+		if sc.Config.AllowPending {
+			return errors.New("schedule failed with pending tests allowed: " + err.Error())
+		}
+		return nil
+	}
+
+	var violations []string
+	violate := func(format string, args ...interface{}) {
+		violations = append(violations, fmt.Sprintf(format, args...))
+	}
+
+	released := make(map[*encoder.Worker]bool)
+	for _, a := range s.Released {
+		released[s.WorkerCollection.FindWorker(a.Worker.Name, a.Worker.Instance)] = true
+	}
+	running := make(map[*encoder.Worker]string)
+	onHost, inGroup := make(map[string]int), make(map[string]int)
+	for _, a := range s.InitialState {
+		w := s.WorkerCollection.FindWorker(a.Worker.Name, a.Worker.Instance)
+		if w.IsOffline() {
+			if !released[w] {
+				violate("%s kept on offline worker %s", a.Test.Name, w.Encode())
+			}
+			continue
+		}
+		running[w] = a.Test.Name
+		onHost[w.GetHost()]++
+		inGroup[a.Test.Group]++
+	}
+	for _, a := range sc.InitialState {
+		w := findWorker(sc, a.Worker, a.Instance)
+		if _, ok := running[w]; !ok && !released[w] {
+			violate("running test %s dropped from %s", a.Test, w.Encode())
+		}
+	}
+	if len(s.Preempted) > 0 {
+		violate("%d running tests preempted without preemption", len(s.Preempted))
+	}
+
+	addedOnHost, addedInGroup := make(map[string]int), make(map[string]int)
+	workerTest := make(map[*encoder.Worker]string)
+	testWorker := make(map[string]*encoder.Worker)
+	for _, a := range ass {
+		if !a.Value {
+			continue
+		}
+		w, t := a.Worker, a.Test
+		if prev, ok := testWorker[t.Name]; ok {
+			violate("%s assigned to both %s and %s", t.Name, prev.Encode(), w.Encode())
+		}
+		testWorker[t.Name] = w
+		if prev, ok := workerTest[w]; ok {
+			violate("%s runs both %s and %s", w.Encode(), prev, t.Name)
+		}
+		workerTest[w] = t.Name
+		if r, ok := running[w]; ok {
+			violate("%s assigned to %s, busy with %s", t.Name, w.Encode(), r)
+		}
+		onHost[w.GetHost()]++
+		addedOnHost[w.GetHost()]++
+		inGroup[t.Group]++
+		addedInGroup[t.Group]++
+
+		if !s.Classes.Satisfies(w, t) {
+			violate("%s doesn't provide the worker class of %s", w.Encode(), t.Name)
+		}
+		if !w.AcceptsJobs() {
+			violate("%s assigned to %s worker %s", t.Name, w.Status, w.Encode())
+		}
+		if t.Parent != "" && (queued[t.Parent] || runningTest(s.InitialState, t.Parent)) {
+			violate("%s assigned before its parent %s finished", t.Name, t.Parent)
+		}
+	}
+
+	for _, a := range ass {
+		if !a.Value {
+			continue
+		}
+		for _, p := range a.Test.Parallel {
+			if _, ok := testWorker[p]; queued[p] && !ok {
+				violate("%s assigned without its parallel peer %s", a.Test.Name, p)
+			}
+		}
+	}
+	for host, capacity := range sc.Config.HostCapacity {
+		if addedOnHost[host] > 0 && onHost[host] > capacity {
+			violate("%s gets new tests, running %d over its capacity of %d", host, onHost[host], capacity)
+		}
+	}
+	for group, quota := range sc.Config.GroupQuota {
+		if addedInGroup[group] > 0 && inGroup[group] > quota {
+			violate("group %s gets new tests, running %d over its quota of %d", group, inGroup[group], quota)
+		}
+	}
+
+	if len(violations) > 0 {
+		sort.Strings(violations)
+		return errors.New(strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+func runningTest(initial []*decoder.Assignment, name string) bool {
+	for _, a := range initial {
+		if a.Value && a.Test.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// copy returns a deep copy of the scenario
+func (sc *Scenario) copy() *Scenario {
+	data, err := json.Marshal(sc)
+	if err != nil {
+		panic(err)
+	}
+	c, err := Parse(data)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// shrinks returns the scenarios one step simpler than sc
+func (sc *Scenario) shrinks() []*Scenario {
+	var res []*Scenario
+	variant := func(change func(c *Scenario)) {
+		c := sc.copy()
+		change(c)
+		res = append(res, c)
+	}
+
+	for i := range sc.Workers {
+		i := i
+		variant(func(c *Scenario) {
+			w := c.Workers[i]
+			c.Workers = append(c.Workers[:i], c.Workers[i+1:]...)
+			var kept []*Assignment
+			for _, a := range c.InitialState {
+				if a.Worker != w.Name || a.Instance != w.Instance {
+					kept = append(kept, a)
+				}
+			}
+			c.InitialState = kept
+		})
+	}
+	for i := range sc.Tests {
+		i := i
+		variant(func(c *Scenario) {
+			name := c.Tests[i].Name
+			c.Tests = append(c.Tests[:i], c.Tests[i+1:]...)
+			// Its peers don't wait for it anymore
+			for _, t := range c.Tests {
+				var kept []string
+				for _, p := range t.Parallel {
+					if p != name {
+						kept = append(kept, p)
+					}
+				}
+				t.Parallel = kept
+			}
+		})
+	}
+	for i := range sc.InitialState {
+		i := i
+		variant(func(c *Scenario) { c.InitialState = append(c.InitialState[:i], c.InitialState[i+1:]...) })
+	}
+	for i, r := range sc.Running {
+		used := false
+		for _, a := range sc.InitialState {
+			used = used || a.Test == r.Name
+		}
+		if !used {
+			i := i
+			variant(func(c *Scenario) { c.Running = append(c.Running[:i], c.Running[i+1:]...) })
+		}
+	}
+	for i, t := range sc.Tests {
+		i := i
+		if len(t.Parallel) > 0 {
+			variant(func(c *Scenario) { c.Tests[i].Parallel, c.Tests[i].HostPolicy = nil, "" })
+		}
+		if t.Parent != "" {
+			variant(func(c *Scenario) { c.Tests[i].Parent = "" })
+		}
+		if t.Priority != 0 {
+			variant(func(c *Scenario) { c.Tests[i].Priority = 0 })
+		}
+	}
+	for i, w := range sc.Workers {
+		i := i
+		if len(w.WorkerClass) > 1 {
+			variant(func(c *Scenario) { c.Workers[i].WorkerClass = c.Workers[i].WorkerClass[:1] })
+		}
+		if w.Status != "" {
+			variant(func(c *Scenario) { c.Workers[i].Status = "" })
+		}
+	}
+	for host := range sc.Config.HostCapacity {
+		host := host
+		variant(func(c *Scenario) { delete(c.Config.HostCapacity, host) })
+	}
+	for group := range sc.Config.GroupQuota {
+		group := group
+		variant(func(c *Scenario) { delete(c.Config.GroupQuota, group) })
+	}
+	return res
+}
+
+// Shrink simplifies sc as long as it keeps failing, and returns the
+// minimal failing scenario found
+func Shrink(sc *Scenario, fails func(*Scenario) bool) *Scenario {
+	for {
+		shrunk := false
+		for _, c := range sc.shrinks() {
+			if fails(c) {
+				sc, shrunk = c, true
+				break
+			}
+		}
+		if !shrunk {
+			return sc
+		}
+	}
+}
+
+// JSON returns the scenario in the scenario file format
+func (sc *Scenario) JSON() ([]byte, error) {
+	return json.MarshalIndent(sc, "", "  ")
+}
@@ -0,0 +1,76 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scenario
+
+import (
+	"flag"
+	"math/rand"
+	"testing"
+)
+
+var (
+	seed  = flag.Int64("seed", 1, "seed of the generated scenarios")
+	cases = flag.Int("cases", 300, "number of generated scenarios")
+)
+
+func TestInvariants(t *testing.T) {
+	n := *cases
+	if testing.Short() {
+		n /= 10
+	}
+	r := rand.New(rand.NewSource(*seed))
+	for i := 0; i < n; i++ {
+		sc := Generate(r)
+		if err := sc.CheckInvariants(); err != nil {
+			min := Shrink(sc, func(c *Scenario) bool { return c.CheckInvariants() != nil })
+			data, _ := min.JSON()
+			t.Fatalf("Scenario %d of seed %d: %v\nMinimal reproduction: %v\n%s", i, *seed, err, min.CheckInvariants(), data)
+		}
+	}
+}
+
+func TestShrink(t *testing.T) {
+	r := rand.New(rand.NewSource(*seed))
+	var sc *Scenario
+	for sc == nil || len(sc.Tests) < 4 || len(sc.Workers) < 3 {
+		sc = Generate(r)
+	}
+
+	// Fails as long as there are two tests and a worker providing qemu64
+	fails := func(c *Scenario) bool {
+		for _, w := range c.Workers {
+			if w.ProvidesWorkerClass("qemu64", nil) {
+				return len(c.Tests) >= 2
+			}
+		}
+		return false
+	}
+	sc.Workers[0].WorkerClass = []string{"qemu64"}
+
+	min := Shrink(sc, fails)
+	if !fails(min) {
+		t.Fatal("Shrunk to a passing scenario")
+	}
+	if len(min.Tests) != 2 || len(min.Workers) != 1 || len(min.InitialState) != 0 || len(min.Config.HostCapacity) != 0 || len(min.Config.GroupQuota) != 0 {
+		data, _ := min.JSON()
+		t.Error("Scenario not minimal", string(data))
+	}
+	for _, test := range min.Tests {
+		if test.Parent != "" || len(test.Parallel) > 0 {
+			t.Error("Relations not shrunk", test)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+// Package scenario describes scheduling cases declaratively in JSON files:
+// workers, tests, the initial state, the scheduler configuration and the
+// expected outcome.
+package scenario
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+	"github.com/mudler/openqa-scheduler-go/scheduler"
+)
+
+type Scenario struct {
+	// Name defaults to the file name, without extension
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	Workers []*encoder.Worker `json:"workers"`
+	Tests   []*encoder.Test   `json:"tests"`
+	// Running are tests of the initial state which are not queued anymore
+	Running      []*encoder.Test `json:"running,omitempty"`
+	InitialState []*Assignment   `json:"initial_state,omitempty"`
+
+	Config Config  `json:"config"`
+	Expect *Expect `json:"expect,omitempty"`
+}
+
+// Assignment is an assignment of the initial state, referring to the
+// worker and the test by name
+type Assignment struct {
+	Test     string `json:"test"`
+	Worker   string `json:"worker"`
+	Instance int    `json:"instance,omitempty"`
+	// Value defaults to true, a running assignment
+	Value *bool `json:"value,omitempty"`
+}
+
+// Config is the scheduler configuration
+type Config struct {
+	AllowPending bool            `json:"allow_pending,omitempty"`
+	Preemption   bool            `json:"preemption,omitempty"`
+	StrictDecode bool            `json:"strict_decode,omitempty"`
+	HostPolicy   string          `json:"host_policy,omitempty"`
+	HostCapacity map[string]int  `json:"host_capacity,omitempty"`
+	GroupQuota   map[string]int  `json:"group_quota,omitempty"`
+	GroupShare   map[string]int  `json:"group_share,omitempty"`
+	Rules        []*encoder.Rule `json:"rules,omitempty"`
+	// Classes is the worker class registry used while scheduling the scenario
+	Classes *encoder.ClassRegistry `json:"classes,omitempty"`
+}
+
+// Expect is the expected outcome of a scenario. Workers are referred to by
+// name, followed by ":instance" when the instance matters.
+type Expect struct {
+	// Error is set if tests can't be assigned
+	Error bool `json:"error,omitempty"`
+	// Assigned maps every newly assigned test to its worker
+	Assigned map[string]string `json:"assigned,omitempty"`
+	// Pending maps every pending test to its reason, any reason if empty
+	Pending   map[string]string `json:"pending,omitempty"`
+	Unchanged []string          `json:"unchanged,omitempty"`
+	Preempted []string          `json:"preempted,omitempty"`
+	Released  []string          `json:"released,omitempty"`
+	// Cost is the expected cost of the solution, if set
+	Cost *int `json:"cost,omitempty"`
+}
+
+// Parse decodes a scenario, rejecting unknown fields
+func Parse(data []byte) (*Scenario, error) {
+	sc := &Scenario{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// Load reads the scenario file at path
+func Load(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if sc.Name == "" {
+		sc.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return sc, nil
+}
+
+// LoadDir reads all the .json scenario files in dir, sorted by file name
+func LoadDir(dir string) ([]*Scenario, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var scenarios []*Scenario
+	for _, p := range paths {
+		sc, err := Load(p)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, sc)
+	}
+	return scenarios, nil
+}
+
+// Collections returns the worker and test collections of the scenario
+func (sc *Scenario) Collections() (*encoder.WorkerColl, *encoder.TestColl) {
+	workers := encoder.NewWorkerColl()
+	for _, w := range sc.Workers {
+		workers.AddWorker(w)
+	}
+	tests := encoder.NewTestColl()
+	for _, t := range sc.Tests {
+		tests.AddTest(t)
+	}
+	return workers, tests
+}
+
+// Scheduler returns a scheduler configured as described by the scenario
+func (sc *Scenario) Scheduler() (*scheduler.Scheduler, error) {
+	workers, tests := sc.Collections()
+	s := scheduler.NewScheduler(workers, tests)
+
+	for _, a := range sc.InitialState {
+		w := workers.FindWorker(a.Worker, a.Instance)
+		if w == nil {
+			return nil, errors.New("Scenario error: unknown worker " + a.Worker)
+		}
+		t := tests.FindTest(a.Test)
+		if t == nil {
+			for _, r := range sc.Running {
+				if r.Name == a.Test {
+					t = r
+				}
+			}
+		}
+		if t == nil {
+			return nil, errors.New("Scenario error: unknown test " + a.Test)
+		}
+		s.InitialState = append(s.InitialState,
+			decoder.NewAssignment(t, w, common.STATE_CURRENT, a.Value == nil || *a.Value))
+	}
+
+	c := sc.Config
+	s.AllowPending = c.AllowPending
+	s.Preemption = c.Preemption
+	s.StrictDecode = c.StrictDecode
+	s.HostPolicy = c.HostPolicy
+	s.Classes = c.Classes
+	for host, capacity := range c.HostCapacity {
+		s.SetHostCapacity(host, capacity)
+	}
+	for group, quota := range c.GroupQuota {
+		s.SetGroupQuota(group, quota)
+	}
+	for group, weight := range c.GroupShare {
+		s.SetGroupShare(group, weight)
+	}
+	if len(c.Rules) > 0 {
+		s.Rules = encoder.NewRuleSet()
+		for _, r := range c.Rules {
+			s.Rules.AddRule(r)
+		}
+	}
+	return s, nil
+}
+
+// Run schedules the scenario
+func (sc *Scenario) Run() (*scheduler.ScheduleResult, error) {
+	s, err := sc.Scheduler()
+	if err != nil {
+		return nil, err
+	}
+	return s.Plan()
+}
+
+func workerName(w *encoder.Worker, expected string) string {
+	if strings.Contains(expected, ":") {
+		return w.Name + ":" + strconv.Itoa(w.Instance)
+	}
+	return w.Name
+}
+
+func testNames(ass []*decoder.Assignment) []string {
+	names := make([]string, 0, len(ass))
+	for _, a := range ass {
+		names = append(names, a.Test.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sameNames(expected, got []string) bool {
+	e := append([]string{}, expected...)
+	sort.Strings(e)
+	return strings.Join(e, ",") == strings.Join(got, ",")
+}
+
+// Check compares the outcome of Run with the expectations of the scenario,
+// and returns an error listing all the differences
+func (sc *Scenario) Check(res *scheduler.ScheduleResult, err error) error {
+	e := sc.Expect
+	if e == nil {
+		return err
+	}
+	if e.Error {
+		if err == nil {
+			return errors.New("Scenario " + sc.Name + ": expected an error")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var diffs []string
+	assigned := make(map[string]bool)
+	for _, a := range res.Assigned {
+		assigned[a.Test.Name] = true
+		expected, ok := e.Assigned[a.Test.Name]
+		if !ok {
+			diffs = append(diffs, "unexpected assignment of "+a.Test.Name+" to "+a.Worker.Encode())
+		} else if got := workerName(a.Worker, expected); got != expected {
+			diffs = append(diffs, a.Test.Name+" assigned to "+got+" instead of "+expected)
+		}
+	}
+	for t, w := range e.Assigned {
+		if !assigned[t] {
+			diffs = append(diffs, t+" not assigned to "+w)
+		}
+	}
+
+	pending := make(map[string]bool)
+	for _, p := range res.Pending {
+		pending[p.Test.Name] = true
+		reason, ok := e.Pending[p.Test.Name]
+		if !ok {
+			diffs = append(diffs, "unexpected pending test "+p.Test.Name)
+		} else if reason != "" && reason != p.Reason {
+			diffs = append(diffs, p.Test.Name+" pending because "+p.Reason+" instead of "+reason)
+		}
+	}
+	for t := range e.Pending {
+		if !pending[t] {
+			diffs = append(diffs, t+" not pending")
+		}
+	}
+
+	if got := testNames(res.Unchanged); !sameNames(e.Unchanged, got) {
+		diffs = append(diffs, fmt.Sprintf("unchanged %v instead of %v", got, e.Unchanged))
+	}
+	if got := testNames(res.Preempted); !sameNames(e.Preempted, got) {
+		diffs = append(diffs, fmt.Sprintf("preempted %v instead of %v", got, e.Preempted))
+	}
+	if got := testNames(res.Released); !sameNames(e.Released, got) {
+		diffs = append(diffs, fmt.Sprintf("released %v instead of %v", got, e.Released))
+	}
+	if e.Cost != nil && (res.Stats == nil || res.Stats.Cost != *e.Cost) {
+		diffs = append(diffs, fmt.Sprintf("cost %v instead of %d", res.Stats, *e.Cost))
+	}
+
+	if len(diffs) > 0 {
+		sort.Strings(diffs)
+		return errors.New("Scenario " + sc.Name + ": " + strings.Join(diffs, "; "))
+	}
+	return nil
+}
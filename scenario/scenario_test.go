@@ -0,0 +1,69 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scenario
+
+import (
+	"testing"
+)
+
+func TestScenarios(t *testing.T) {
+	scenarios, err := LoadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenarios) == 0 {
+		t.Fatal("No scenarios found")
+	}
+
+	for _, sc := range scenarios {
+		sc := sc
+		t.Run(sc.Name, func(t *testing.T) {
+			res, err := sc.Run()
+			if err := sc.Check(res, err); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse([]byte(`{"workers": [], "tests": [], "wokers": []}`)); err == nil {
+		t.Error("Parsed a scenario with unknown fields")
+	}
+
+	sc, err := Parse([]byte(`{
+		"workers": [{"name": "mudler", "worker_class": ["developer"]}],
+		"tests": [{"name": "lunch", "worker_class": ["developer"]}],
+		"initial_state": [{"test": "dinner", "worker": "mudler"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.Scheduler(); err == nil {
+		t.Error("Scheduled a scenario with an unknown running test")
+	}
+
+	sc.InitialState = nil
+	sc.Expect = &Expect{Assigned: map[string]string{"lunch": "boss"}}
+	res, err := sc.Run()
+	if err := sc.Check(res, err); err == nil {
+		t.Error("Wrong assignment not reported")
+	}
+	sc.Expect.Assigned["lunch"] = "mudler"
+	if err := sc.Check(res, err); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// AgingPolicy raises the priority of a test by Step for every Interval it
+// has been waiting since its submission, up to Max (no limit if 0).
+type AgingPolicy struct {
+	Interval time.Duration
+	Step     int
+	Max      int
+}
+
+func NewAgingPolicy(interval time.Duration, step int) *AgingPolicy {
+	return &AgingPolicy{Interval: interval, Step: step}
+}
+
+// Bonus returns the priority gained after waiting for wait
+func (a *AgingPolicy) Bonus(wait time.Duration) int {
+	if a.Interval <= 0 || wait <= 0 {
+		return 0
+	}
+	bonus := int(wait/a.Interval) * a.Step
+	if a.Max > 0 && bonus > a.Max {
+		return a.Max
+	}
+	return bonus
+}
+
+func (s *Scheduler) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// EffectivePriority returns the priority of t raised by the aging policy.
+// It weights pending tests in the objective, while preemption keeps using
+// the plain priority so that running tests are not cancelled just because
+// others waited for long.
+func (s *Scheduler) EffectivePriority(t *encoder.Test) int {
+	if s.Aging == nil || t.Submitted.IsZero() {
+		return t.Priority
+	}
+	return t.Priority + s.Aging.Bonus(s.now().Sub(t.Submitted))
+}
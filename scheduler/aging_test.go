@@ -0,0 +1,105 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func TestAgingBonus(t *testing.T) {
+	a := NewAgingPolicy(time.Minute, 2)
+
+	if a.Bonus(30*time.Second) != 0 || a.Bonus(5*time.Minute) != 10 {
+		t.Error("Wrong aging bonus", a.Bonus(30*time.Second), a.Bonus(5*time.Minute))
+	}
+	a.Max = 6
+	if a.Bonus(5*time.Minute) != 6 {
+		t.Error("Aging bonus over the maximum", a.Bonus(5*time.Minute))
+	}
+
+	// Tests only wait with AllowPending, the policy does nothing otherwise
+	s := NewScheduler(encoder.NewWorkerColl(), encoder.NewTestColl())
+	s.Aging = a
+	if w := s.Validate().Warnings(); len(w) != 1 || w[0].Kind != common.INVALID_NO_PENDING {
+		t.Error("Expected a warning about the aging policy", w)
+	}
+	s.AllowPending = true
+	if w := s.Validate().Warnings(); len(w) != 0 {
+		t.Error("Unexpected warnings", w)
+	}
+}
+
+// simulateStarvation runs one scheduling round per minute on a single worker,
+// with an urgent test submitted every round competing against one starving
+// test. Assigned tests are done by the next round. It returns the round the
+// starving test got assigned at, or -1.
+func simulateStarvation(t *testing.T, aging *AgingPolicy, rounds int) int {
+	clock := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	workers := encoder.NewWorkerColl()
+	workers.NewWorker("worker").AddWorkerClass("qemu64")
+
+	tests := encoder.NewTestColl()
+	starving := tests.NewTest("starving")
+	starving.AddWorkerClass("qemu64")
+	starving.SetSubmitted(clock)
+
+	for round := 0; round < rounds; round++ {
+		urgent := tests.NewTest(fmt.Sprintf("urgent%d", round))
+		urgent.AddWorkerClass("qemu64")
+		urgent.SetPriority(10)
+		urgent.SetSubmitted(clock)
+
+		s := NewScheduler(workers, tests)
+		s.AllowPending = true
+		s.Aging = aging
+		s.Now = func() time.Time { return clock }
+
+		model, _, err := s.Schedule()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests = encoder.NewTestColl()
+		for _, p := range s.PendingTests(model) {
+			tests.AddTest(p)
+		}
+		if tests.FindTest("starving") == nil {
+			return round
+		}
+		clock = clock.Add(time.Minute)
+	}
+
+	return -1
+}
+
+func TestAgingStarvation(t *testing.T) {
+	if round := simulateStarvation(t, nil, 20); round != -1 {
+		t.Fatal("Expected starvation without aging, assigned at round", round)
+	}
+
+	// The starving test outranks the urgent ones once it gained more than
+	// the priority gap, so the wait is bounded by gap/step+1 intervals
+	bound := 10/2 + 1
+	if round := simulateStarvation(t, NewAgingPolicy(time.Minute, 2), 20); round < 0 || round > bound {
+		t.Error("Starving test waited more than", bound, "rounds:", round)
+	}
+}
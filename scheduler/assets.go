@@ -0,0 +1,43 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+// MissingAssetWeight is the penalty for each asset a worker has to download
+// to run a test. It is way lower than PendingWeight: cache locality decides
+// where tests go, never whether they go.
+const MissingAssetWeight = 1
+
+// addAssetPenalties penalizes the assignments of tests to workers that don't
+// have their assets cached. The penalty of an assignment stays below the one
+// of leaving its test pending, so that no test waits for a worker caching
+// its assets when another one could run it.
+func (s *Scheduler) addAssetPenalties() {
+	for _, t := range s.TestCollection.Tests {
+		if len(t.Assets) == 0 {
+			continue
+		}
+		for _, w := range s.WorkerCollection.Workers {
+			if !s.canRun(w, t) {
+				continue
+			}
+			penalty := w.MissingAssets(t) * MissingAssetWeight
+			if max := s.pendingWeight(t) - 1; penalty > max {
+				penalty = max
+			}
+			s.AddPenalty(s.Assign(w, t), penalty)
+		}
+	}
+}
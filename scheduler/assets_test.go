@@ -0,0 +1,89 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func TestAssetLocality(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	for i := 1; i <= 3; i++ {
+		w := workers.NewWorker("host")
+		w.Instance = i
+		w.AddWorkerClass("qemu64")
+	}
+	workers.Workers[1].AddAsset("sle-15.qcow2")
+	workers.Workers[2].AddAsset("sle-15.qcow2")
+	workers.Workers[2].AddAsset("sle-15.iso")
+
+	upgrade := tests.NewTest("upgrade")
+	upgrade.AddWorkerClass("qemu64")
+	upgrade.AddAsset("sle-15.qcow2")
+	upgrade.AddAsset("sle-15.iso")
+
+	s := NewScheduler(workers, tests)
+	for i := 0; i < 5; i++ {
+		ass, err := s.ScheduleDecode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range ass {
+			if a.Value && a.Worker.Instance != 3 {
+				t.Error("Test not assigned to the worker caching its assets", a.Worker.Instance)
+			}
+		}
+	}
+
+	// Preference only: the test still runs where assets are missing
+	workers.Workers[1].SetStatus(common.WORKER_OFFLINE)
+	workers.Workers[2].SetStatus(common.WORKER_OFFLINE)
+	ass, err := s.ScheduleDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ass) != 1 || !ass[0].Value || ass[0].Worker.Instance != 1 {
+		t.Error("Test not assigned to the worker without assets", ass)
+	}
+}
+
+func TestAssetsNeverKeepPending(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	workers.NewWorker("w1").AddWorkerClass("qemu64")
+	nightly := tests.NewTest("nightly")
+	nightly.AddWorkerClass("qemu64")
+	nightly.SetPriority(-(PendingWeight - 2))
+	for _, a := range []string{"sle-15.qcow2", "sle-15.iso", "sle-15-sdk.iso", "sle-15-we.iso"} {
+		nightly.AddAsset(a)
+	}
+
+	s := NewScheduler(workers, tests)
+	s.AllowPending = true
+	res, err := s.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Assigned) != 1 || len(res.Pending) != 0 {
+		t.Error("Low priority test left pending for its missing assets", res.Pending)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/crillab/gophersat/bf"
+	"github.com/mudler/openqa-scheduler-go/common"
+)
+
+// and is like bf.And, but it holds when there is nothing to conjunct
+// instead of turning into a contradiction.
+func and(subs ...bf.Formula) bf.Formula {
+	var res []bf.Formula
+	for _, f := range subs {
+		if f != bf.True {
+			res = append(res, f)
+		}
+	}
+	if len(res) == 0 {
+		return bf.True
+	}
+	return bf.And(res...)
+}
+
+// atMost returns a formula that holds if at most k of vars are true.
+// It uses a sequential counter encoding (Sinz, 2005), which is linear in
+// len(vars)*k instead of enumerating all the combinations. The auxiliary
+// counter variables are named after prefix, which must be unique per constraint.
+func atMost(prefix string, k int, vars ...bf.Formula) bf.Formula {
+	n := len(vars)
+	if k >= n {
+		return bf.True
+	}
+	if k <= 0 {
+		none := make([]bf.Formula, 0, n)
+		for _, v := range vars {
+			none = append(none, bf.Not(v))
+		}
+		return bf.And(none...)
+	}
+
+	// counter(i, j) holds if at least j+1 of the vars up to i are true
+	counter := func(i, j int) bf.Formula {
+		return bf.Var(fmt.Sprintf(common.CounterFmt, prefix, i, j))
+	}
+
+	clauses := []bf.Formula{bf.Or(bf.Not(vars[0]), counter(0, 0))}
+	for j := 1; j < k; j++ {
+		clauses = append(clauses, bf.Not(counter(0, j)))
+	}
+	for i := 1; i < n-1; i++ {
+		clauses = append(clauses,
+			bf.Or(bf.Not(vars[i]), counter(i, 0)),
+			bf.Or(bf.Not(counter(i-1, 0)), counter(i, 0)),
+		)
+		for j := 1; j < k; j++ {
+			clauses = append(clauses,
+				bf.Or(bf.Not(vars[i]), bf.Not(counter(i-1, j-1)), counter(i, j)),
+				bf.Or(bf.Not(counter(i-1, j)), counter(i, j)),
+			)
+		}
+		clauses = append(clauses, bf.Or(bf.Not(vars[i]), bf.Not(counter(i-1, k-1))))
+	}
+	clauses = append(clauses, bf.Or(bf.Not(vars[n-1]), bf.Not(counter(n-2, k-1))))
+
+	return bf.And(clauses...)
+}
+
+// atMostRunning is atMost over the new assignments vars and the running
+// assignments of the initial state. Running assignments are only counted
+// under preemption, where they can be revoked, otherwise they use up part of
+// k. A bound below the running assignments only prevents new ones instead of
+// making the formula unsatisfiable.
+func (s *Scheduler) atMostRunning(prefix string, k int, running, vars []bf.Formula) bf.Formula {
+	if !s.Preemption {
+		k -= len(running)
+		if k < 0 {
+			k = 0
+		}
+		return atMost(prefix, k, vars...)
+	}
+	if k < len(running) {
+		k = len(running)
+	}
+	return atMost(prefix, k, append(append([]bf.Formula{}, running...), vars...)...)
+}
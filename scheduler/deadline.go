@@ -0,0 +1,134 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// DeadlinePolicy favours the tests with the smallest slack: a test gets up to
+// Weight extra priority, growing linearly as its slack shrinks from Horizon
+// to zero. Tests past their deadline get the whole Weight.
+type DeadlinePolicy struct {
+	Horizon time.Duration
+	Weight  int
+}
+
+func NewDeadlinePolicy(horizon time.Duration, weight int) *DeadlinePolicy {
+	return &DeadlinePolicy{Horizon: horizon, Weight: weight}
+}
+
+// Bonus returns the extra priority of a test with the given slack
+func (d *DeadlinePolicy) Bonus(slack time.Duration) int {
+	if slack <= 0 || d.Horizon <= 0 {
+		return d.Weight
+	}
+	if slack >= d.Horizon {
+		return 0
+	}
+	return int(int64(d.Weight) * int64(d.Horizon-slack) / int64(d.Horizon))
+}
+
+func (s *Scheduler) deadlineBonus(t *encoder.Test) int {
+	if s.Deadlines == nil || !t.HasDeadline() {
+		return 0
+	}
+	return s.Deadlines.Bonus(t.Slack(s.now()))
+}
+
+// MissedDeadline is a test that is not going to start before its deadline.
+// Start is the forecasted start, zero if no worker can ever run the test.
+type MissedDeadline struct {
+	Test  *encoder.Test `json:"test"`
+	Start time.Time     `json:"start"`
+}
+
+// MissedDeadlines forecasts which tests are going to miss their deadline with
+// the assignments of model. Pending tests are placed earliest deadline first
+// on the worker that frees up first, as assigned tests end after their
+// expected duration, and running tests after their expected duration from
+// their start. Running tests without a start time are assumed to start now,
+// and the ones taking longer than expected to end now. Tests without a
+// duration estimate take no time.
+func (s *Scheduler) MissedDeadlines(model map[string]bool) []*MissedDeadline {
+	var missed []*MissedDeadline
+	now := s.now()
+
+	free := make(map[*encoder.Worker]time.Time)
+	busy := func(w *encoder.Worker, until time.Time) {
+		if until.After(free[w]) {
+			free[w] = until
+		}
+	}
+	for _, w := range s.WorkerCollection.Workers {
+		if w.AcceptsJobs() {
+			free[w] = now
+		}
+	}
+	for _, a := range s.InitialState {
+		if a.Value && model[a.Encode()] {
+			t, start := s.resolveTest(a.Test), now
+			if !t.Started.IsZero() {
+				start = t.Started
+			}
+			busy(s.resolveWorker(a.Worker), start.Add(t.Duration))
+		}
+	}
+	for _, a := range s.assignments(model) {
+		if !a.Value || a.State != common.STATE_CURRENT {
+			continue
+		}
+		t := a.Test
+		busy(a.Worker, now.Add(t.Duration))
+		if t.HasDeadline() && now.After(t.Deadline) {
+			missed = append(missed, &MissedDeadline{Test: t, Start: now})
+		}
+	}
+
+	pending := s.PendingTests(model)
+	sort.SliceStable(pending, func(i, j int) bool {
+		if pending[i].HasDeadline() != pending[j].HasDeadline() {
+			return pending[i].HasDeadline()
+		}
+		return pending[i].Deadline.Before(pending[j].Deadline)
+	})
+
+	for _, t := range pending {
+		var first *encoder.Worker
+		for _, w := range s.WorkerCollection.Workers {
+			if _, ok := free[w]; ok && s.canRun(w, t) && (first == nil || free[w].Before(free[first])) {
+				first = w
+			}
+		}
+		if first == nil {
+			if t.HasDeadline() {
+				missed = append(missed, &MissedDeadline{Test: t})
+			}
+			continue
+		}
+		start := free[first]
+		free[first] = start.Add(t.Duration)
+		if t.HasDeadline() && start.After(t.Deadline) {
+			missed = append(missed, &MissedDeadline{Test: t, Start: start})
+		}
+	}
+
+	return missed
+}
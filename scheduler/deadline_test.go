@@ -0,0 +1,133 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func TestDeadlineBonus(t *testing.T) {
+	d := NewDeadlinePolicy(time.Hour, 100)
+
+	if d.Bonus(2*time.Hour) != 0 || d.Bonus(30*time.Minute) != 50 || d.Bonus(-time.Minute) != 100 {
+		t.Error("Wrong deadline bonus", d.Bonus(2*time.Hour), d.Bonus(30*time.Minute), d.Bonus(-time.Minute))
+	}
+}
+
+func TestDeadlines(t *testing.T) {
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	workers.NewWorker("worker").AddWorkerClass("qemu64")
+
+	rc := tests.NewTest("release_candidate")
+	rc.AddWorkerClass("qemu64")
+	rc.SetDeadline(now.Add(10 * time.Minute))
+	rc.SetDuration(30 * time.Minute)
+
+	update := tests.NewTest("security_update")
+	update.AddWorkerClass("qemu64")
+	update.SetDeadline(now.Add(20 * time.Minute))
+	update.SetDuration(30 * time.Minute)
+
+	nightly := tests.NewTest("nightly")
+	nightly.AddWorkerClass("qemu64")
+	nightly.SetPriority(50)
+	nightly.SetDuration(time.Hour)
+
+	s := NewScheduler(workers, tests)
+	s.AllowPending = true
+	s.Now = func() time.Time { return now }
+
+	ass, err := s.ScheduleDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range ass {
+		if a.Value && a.Test.Name != "nightly" {
+			t.Error("Expected the most urgent test assigned without deadline policy", a.Test.Name)
+		}
+	}
+	if len(s.Missed) != 2 {
+		t.Error("Expected both deadlines missed", s.Missed)
+	}
+
+	s.Deadlines = NewDeadlinePolicy(time.Hour, 100)
+	ass, err = s.ScheduleDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range ass {
+		if a.Value && a.Test.Name != "release_candidate" {
+			t.Error("Expected the test with the smallest slack assigned", a.Test.Name)
+		}
+	}
+	if len(s.Missed) != 1 || s.Missed[0].Test != update || !s.Missed[0].Start.Equal(now.Add(30*time.Minute)) {
+		t.Fatal("Expected the security update to miss its deadline", s.Missed)
+	}
+}
+
+func TestMissedDeadlinesRunning(t *testing.T) {
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	w := workers.NewWorker("worker")
+	w.AddWorkerClass("qemu64")
+
+	rc := tests.NewTest("release_candidate")
+	rc.AddWorkerClass("qemu64")
+	rc.SetDeadline(now.Add(15 * time.Minute))
+
+	build := &encoder.Test{Name: "build", WorkerClass: []string{"qemu64"}, Duration: 30 * time.Minute}
+	s := NewScheduler(workers, tests)
+	s.AllowPending = true
+	s.Now = func() time.Time { return now }
+	s.InitialState = []*decoder.Assignment{decoder.NewAssignment(build, w, common.STATE_CURRENT, true)}
+
+	// Without a start time the build is assumed to start now
+	if _, err := s.ScheduleDecode(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Missed) != 1 || !s.Missed[0].Start.Equal(now.Add(30*time.Minute)) {
+		t.Error("Expected the deadline missed after the whole build", s.Missed)
+	}
+
+	// It ends 30 minutes after its start
+	build.SetStarted(now.Add(-20 * time.Minute))
+	if _, err := s.ScheduleDecode(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Missed) != 0 {
+		t.Error("Expected the deadline met after the rest of the build", s.Missed)
+	}
+
+	// Overrunning tests are assumed to end now
+	build.SetStarted(now.Add(-time.Hour))
+	rc.SetDeadline(now.Add(-time.Minute))
+	if _, err := s.ScheduleDecode(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Missed) != 1 || !s.Missed[0].Start.Equal(now) {
+		t.Error("Expected the overrunning build to end now", s.Missed)
+	}
+}
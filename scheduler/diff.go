@@ -0,0 +1,184 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// WorkerChanges lists the tests a schedule adds, keeps and revokes on a worker
+type WorkerChanges struct {
+	Added    []string `json:"added,omitempty"`
+	Kept     []string `json:"kept,omitempty"`
+	Revoked  []string `json:"revoked,omitempty"`
+	Released []string `json:"released,omitempty"`
+}
+
+// TestChange is the change a schedule makes to a test
+type TestChange struct {
+	Change string `json:"change"`
+	Worker string `json:"worker"`
+}
+
+// Diff is what applying a schedule would change on the initial state.
+// Workers and tests are keyed by name:instance and name.
+type Diff struct {
+	// Added are the new assignments
+	Added []*decoder.Assignment `json:"-"`
+	// Kept are the running assignments left untouched
+	Kept []*decoder.Assignment `json:"-"`
+	// Revoked are the running assignments preempted
+	Revoked []*decoder.Assignment `json:"-"`
+	// Released are the running assignments dropped from offline workers
+	Released []*decoder.Assignment `json:"-"`
+
+	Workers map[string]*WorkerChanges `json:"workers"`
+	Tests   map[string]*TestChange    `json:"tests"`
+	Pending []*PendingTest            `json:"pending,omitempty"`
+}
+
+func workerLabel(w *encoder.Worker) string {
+	return w.Name + ":" + strconv.Itoa(w.Instance)
+}
+
+// NewDiff returns the changes of a schedule result to its initial state
+func NewDiff(res *ScheduleResult) *Diff {
+	d := &Diff{
+		Added:    res.Assigned,
+		Kept:     res.Unchanged,
+		Revoked:  res.Preempted,
+		Released: res.Released,
+		Workers:  make(map[string]*WorkerChanges),
+		Tests:    make(map[string]*TestChange),
+		Pending:  res.Pending,
+	}
+
+	add := func(ass []*decoder.Assignment, change string) {
+		for _, a := range ass {
+			label := workerLabel(a.Worker)
+			w, ok := d.Workers[label]
+			if !ok {
+				w = &WorkerChanges{}
+				d.Workers[label] = w
+			}
+			switch change {
+			case common.DIFF_ADDED:
+				w.Added = append(w.Added, a.Test.Name)
+			case common.DIFF_KEPT:
+				w.Kept = append(w.Kept, a.Test.Name)
+			case common.DIFF_REVOKED:
+				w.Revoked = append(w.Revoked, a.Test.Name)
+			case common.DIFF_RELEASED:
+				w.Released = append(w.Released, a.Test.Name)
+			}
+			d.Tests[a.Test.Name] = &TestChange{Change: change, Worker: label}
+		}
+	}
+	add(d.Kept, common.DIFF_KEPT)
+	add(d.Revoked, common.DIFF_REVOKED)
+	add(d.Released, common.DIFF_RELEASED)
+	add(d.Added, common.DIFF_ADDED)
+
+	for _, w := range d.Workers {
+		sort.Strings(w.Added)
+		sort.Strings(w.Kept)
+		sort.Strings(w.Revoked)
+		sort.Strings(w.Released)
+	}
+	return d
+}
+
+// Diff plans a schedule and returns what it would change, without applying
+// anything
+func (s *Scheduler) Diff() (*Diff, error) {
+	res, err := s.Plan()
+	if err != nil {
+		return nil, err
+	}
+	return NewDiff(res), nil
+}
+
+// Empty is true if the schedule changes nothing
+func (d *Diff) Empty() bool {
+	return len(d.Added)+len(d.Revoked)+len(d.Released) == 0
+}
+
+func (d *Diff) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+var diffMarks = map[string]string{
+	common.DIFF_ADDED:    "+",
+	common.DIFF_KEPT:     "=",
+	common.DIFF_REVOKED:  "-",
+	common.DIFF_RELEASED: "-",
+}
+
+// String returns the diff in a human readable form: the changes per worker,
+// then per test, marking added tests with +, kept ones with = and revoked or
+// released ones with -
+func (d *Diff) String() string {
+	var b bytes.Buffer
+
+	fmt.Fprintln(&b, "Workers:")
+	var labels []string
+	for label := range d.Workers {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		w := d.Workers[label]
+		fmt.Fprintf(&b, "  %s\n", label)
+		for _, t := range w.Added {
+			fmt.Fprintf(&b, "    + %s\n", t)
+		}
+		for _, t := range w.Kept {
+			fmt.Fprintf(&b, "    = %s\n", t)
+		}
+		for _, t := range w.Revoked {
+			fmt.Fprintf(&b, "    - %s (%s)\n", t, common.DIFF_REVOKED)
+		}
+		for _, t := range w.Released {
+			fmt.Fprintf(&b, "    - %s (%s)\n", t, common.DIFF_RELEASED)
+		}
+	}
+
+	fmt.Fprintln(&b, "Tests:")
+	var names []string
+	for name := range d.Tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := d.Tests[name]
+		fmt.Fprintf(&b, "  %s %s %s on %s\n", diffMarks[t.Change], name, t.Change, t.Worker)
+	}
+	for _, p := range d.Pending {
+		fmt.Fprintf(&b, "  ? %s pending: %s\n", p.Test.Name, p.Reason)
+	}
+
+	fmt.Fprintf(&b, "%d added, %d kept, %d revoked, %d released, %d pending\n",
+		len(d.Added), len(d.Kept), len(d.Revoked), len(d.Released), len(d.Pending))
+	return b.String()
+}
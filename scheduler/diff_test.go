@@ -0,0 +1,82 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+)
+
+func TestDiff(t *testing.T) {
+	s, _ := busyWorkers(3)
+	s.Preemption = true
+
+	d, err := s.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Added) != 1 || len(d.Kept) != 2 || len(d.Revoked) != 1 || d.Empty() {
+		t.Fatal("Wrong diff", d)
+	}
+
+	revoked := d.Tests[d.Revoked[0].Test.Name]
+	if revoked.Change != common.DIFF_REVOKED {
+		t.Error("Expected the preempted test revoked", revoked)
+	}
+	high := d.Tests["high"]
+	if high == nil || high.Change != common.DIFF_ADDED || high.Worker != revoked.Worker {
+		t.Error("Expected high added on the preempted worker", high, revoked)
+	}
+	w := d.Workers[revoked.Worker]
+	if len(w.Added) != 1 || len(w.Revoked) != 1 || len(w.Kept) != 0 {
+		t.Error("Wrong worker diff", w)
+	}
+
+	out := d.String()
+	for _, line := range []string{"  " + revoked.Worker + "\n    + high\n    - ", "  + high added on " + revoked.Worker, "1 added, 2 kept, 1 revoked, 0 released, 0 pending"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Expected %q in\n%s", line, out)
+		}
+	}
+
+	data, err := d.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Diff
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Tests["high"].Worker != revoked.Worker || len(decoded.Workers) != 3 {
+		t.Error("Wrong JSON diff", string(data))
+	}
+}
+
+func TestDiffUnchanged(t *testing.T) {
+	s, _ := busyWorkers(2)
+	s.AllowPending = true
+
+	d, err := s.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Empty() || len(d.Kept) != 2 || len(d.Pending) != 1 {
+		t.Error("Expected only kept tests", d)
+	}
+}
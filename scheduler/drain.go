@@ -0,0 +1,71 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// ReleaseOffline returns the assignments of the initial state on offline
+// and broken workers. Plan and Schedule release them: they run on a copy of
+// the initial state without them, and of the test collection with their
+// tests queued again, leaving both unchanged. Draining workers keep their
+// assignments, they just don't get new ones.
+func (s *Scheduler) ReleaseOffline() []*decoder.Assignment {
+	var released []*decoder.Assignment
+	for _, a := range s.InitialState {
+		if a.Worker != nil && s.resolveWorker(a.Worker).IsOffline() {
+			released = append(released, a)
+		}
+	}
+	return released
+}
+
+// release replaces the initial state and the test collection with the
+// copies ReleaseOffline describes, and records the released assignments in
+// s.Released. The returned function restores the originals.
+func (s *Scheduler) release() func() {
+	state, tests := s.InitialState, s.TestCollection
+	s.Released = s.ReleaseOffline()
+	if len(s.Released) == 0 {
+		return func() {}
+	}
+
+	released := make(map[*decoder.Assignment]bool)
+	for _, a := range s.Released {
+		released[a] = true
+	}
+	s.InitialState = nil
+	for _, a := range state {
+		if !released[a] {
+			s.InitialState = append(s.InitialState, a)
+		}
+	}
+	s.TestCollection = &encoder.TestColl{Tests: append([]*encoder.Test{}, tests.Tests...)}
+	for _, a := range s.Released {
+		if a.Test == nil {
+			continue
+		}
+		s.logger().Info("releasing assignment of offline worker", "test", a.Test.Name, "worker", a.Worker.Encode())
+		if a.Value && s.TestCollection.FindTest(a.Test.Name) == nil {
+			s.TestCollection.AddTest(a.Test)
+		}
+	}
+	return func() {
+		s.InitialState, s.TestCollection = state, tests
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func TestDrainingWorker(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	w1 := workers.NewWorker("mudler")
+	w1.AddWorkerClass("developer")
+	w1.SetStatus(common.WORKER_DRAINING)
+	w2 := workers.NewWorker("mudler_away")
+	w2.AddWorkerClass("developer")
+
+	meeting := encoder.NewTest("meeting")
+	meeting.AddWorkerClass("developer")
+	tests.NewTest("lunch").AddWorkerClass("developer")
+
+	s := NewScheduler(workers, tests)
+	s.InitialState = []*decoder.Assignment{decoder.NewAssignment(meeting, w1, common.STATE_CURRENT, true)}
+
+	ass, err := s.ScheduleDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range ass {
+		if a.Value && a.Worker.Name != "mudler_away" {
+			t.Error("Draining worker got a new test", a.Worker.Name, a.Test.Name)
+		}
+	}
+	if len(s.InitialState) != 1 || len(s.Released) != 0 {
+		t.Error("Draining worker lost its running test")
+	}
+
+	w2.SetStatus(common.WORKER_DRAINING)
+	if _, err := s.ScheduleDecode(); err == nil {
+		t.Error("Test assigned with all workers draining")
+	}
+}
+
+func TestOfflineWorker(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	w1 := workers.NewWorker("mudler")
+	w1.AddWorkerClass("developer")
+	w2 := workers.NewWorker("mudler_away")
+	w2.AddWorkerClass("developer")
+
+	lunch := encoder.NewTest("lunch")
+	lunch.AddWorkerClass("developer")
+
+	s := NewScheduler(workers, tests)
+	s.InitialState = []*decoder.Assignment{decoder.NewAssignment(lunch, w1, common.STATE_CURRENT, true)}
+	w1.SetStatus(common.WORKER_OFFLINE)
+
+	ass, err := s.ScheduleDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Released) != 1 {
+		t.Fatal("Assignment of the offline worker not released", s.Released)
+	}
+	if len(s.InitialState) != 1 || len(tests.Tests) != 0 {
+		t.Fatal("Releasing changed the initial state or the tests", s.InitialState, tests.Tests)
+	}
+
+	found := false
+	for _, a := range ass {
+		if a.Value {
+			if a.Worker.Name != "mudler_away" || a.Test.Name != "lunch" {
+				t.Error("Wrong assignment", a.Worker.Name, a.Test.Name)
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Released test not assigned again")
+	}
+
+	// Planning again releases the same assignment, and the formula is the same
+	f := s.BuildFormula().String()
+	res, err := s.Plan()
+	if err != nil || len(res.Released) != 1 || testNames(res.Assigned) != "lunch" {
+		t.Fatal("Assignment not released again", res, err)
+	}
+	if len(s.InitialState) != 1 || len(tests.Tests) != 0 || s.BuildFormula().String() != f {
+		t.Error("Planning changed the scheduler", s.InitialState, tests.Tests)
+	}
+}
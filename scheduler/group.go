@@ -0,0 +1,173 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"github.com/crillab/gophersat/bf"
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+)
+
+// GroupUsage is how many workers a job group is using
+type GroupUsage struct {
+	Group    string `json:"group"`
+	Quota    int    `json:"quota,omitempty"`
+	Share    int    `json:"share,omitempty"`
+	Running  int    `json:"running"`
+	Assigned int    `json:"assigned"`
+	Pending  int    `json:"pending"`
+}
+
+// SetGroupQuota caps the number of workers used at the same time by group,
+// counting the tests already running.
+func (s *Scheduler) SetGroupQuota(group string, workers int) {
+	if s.GroupQuota == nil {
+		s.GroupQuota = make(map[string]int)
+	}
+	s.GroupQuota[group] = workers
+}
+
+// SetGroupShare sets the weight of group when sharing the workers of each class.
+// Among the groups having tests for a worker class, each one can use at most
+// its weighted share of the workers providing it.
+func (s *Scheduler) SetGroupShare(group string, weight int) {
+	if s.GroupShare == nil {
+		s.GroupShare = make(map[string]int)
+	}
+	s.GroupShare[group] = weight
+}
+
+// assignedGroup returns the group of the test of a, as found in the test
+// collection, or as in a if the test isn't queued. It returns false if a has
+// no test.
+func (s *Scheduler) assignedGroup(a *decoder.Assignment) (string, bool) {
+	if a.Test == nil {
+		return "", false
+	}
+	return s.resolveTest(a.Test).Group, true
+}
+
+// groupAssignments returns the running and the new assignments of tests of
+// group on workers providing class. An empty class matches every worker.
+func (s *Scheduler) groupAssignments(group, class string) (running, vars []bf.Formula) {
+	for _, a := range s.InitialState {
+		if g, ok := s.assignedGroup(a); !a.Value || !ok || g != group {
+			continue
+		}
+		if class == "" || s.Classes.Provides(s.resolveWorker(a.Worker), class) {
+			running = append(running, bf.Var(a.Encode()))
+		}
+	}
+	for _, t := range s.TestCollection.Tests {
+		if t.Group != group || (class != "" && !s.Classes.Requires(t, class)) {
+			continue
+		}
+		for _, w := range s.WorkerCollection.Workers {
+			if s.canRun(w, t) && (class == "" || s.Classes.Provides(w, class)) {
+				vars = append(vars, bf.Var(s.Assign(w, t)))
+			}
+		}
+	}
+	return running, vars
+}
+
+// BuildGroupFormula returns the quota and fair share constraints of the job groups
+func (s *Scheduler) BuildGroupFormula() bf.Formula {
+	f := bf.True
+
+	for _, group := range sortedKeys(s.GroupQuota) {
+		running, vars := s.groupAssignments(group, "")
+		f = and(f, s.atMostRunning(common.GroupQuotaPrefix+group, s.GroupQuota[group], running, vars))
+	}
+
+	if len(s.GroupShare) == 0 {
+		return f
+	}
+
+	classes := s.classWorkers()
+	for _, class := range sortedKeys(classes) {
+		workers := classes[class]
+		running := make(map[string][]bf.Formula)
+		vars := make(map[string][]bf.Formula)
+		var groups []string
+		total := 0
+		for _, group := range sortedKeys(s.GroupShare) {
+			r, v := s.groupAssignments(group, class)
+			if len(r)+len(v) > 0 && s.GroupShare[group] > 0 {
+				running[group], vars[group] = r, v
+				groups = append(groups, group)
+				total += s.GroupShare[group]
+			}
+		}
+		for _, group := range groups {
+			share := (workers*s.GroupShare[group] + total - 1) / total
+			f = and(f, s.atMostRunning(common.GroupSharePrefix+group+common.CounterSep+class, share, running[group], vars[group]))
+		}
+	}
+
+	return f
+}
+
+// classWorkers counts the workers providing each worker class, except the
+// offline ones
+func (s *Scheduler) classWorkers() map[string]int {
+	classes := make(map[string]int)
+	for _, w := range s.WorkerCollection.Workers {
+		if w.IsOffline() {
+			continue
+		}
+		provided := make(map[string]bool)
+		for _, w1 := range w.WorkerClass {
+			for _, c := range s.Classes.Provided(w1) {
+				provided[c] = true
+			}
+		}
+		for c := range provided {
+			classes[c]++
+		}
+	}
+	return classes
+}
+
+// GroupUsage reports the usage of every job group in model
+func (s *Scheduler) GroupUsage(model map[string]bool) map[string]*GroupUsage {
+	groups := make(map[string]*GroupUsage)
+	usage := func(group string) *GroupUsage {
+		if _, ok := groups[group]; !ok {
+			groups[group] = &GroupUsage{Group: group, Quota: s.GroupQuota[group], Share: s.GroupShare[group]}
+		}
+		return groups[group]
+	}
+
+	for _, a := range s.InitialState {
+		if g, ok := s.assignedGroup(a); ok && a.Value && model[a.Encode()] {
+			usage(g).Running++
+		}
+	}
+	pending := make(map[string]bool)
+	for _, t := range s.PendingTests(model) {
+		pending[t.Name] = true
+	}
+	for _, t := range s.TestCollection.Tests {
+		if pending[t.Name] {
+			usage(t.Group).Pending++
+		} else {
+			usage(t.Group).Assigned++
+		}
+	}
+
+	return groups
+}
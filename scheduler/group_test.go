@@ -0,0 +1,140 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func groupScheduler(workers int, groups ...string) *Scheduler {
+	tc := encoder.NewTestColl()
+	wc := encoder.NewWorkerColl()
+
+	for i := 1; i <= workers; i++ {
+		w := wc.NewWorker("host")
+		w.Instance = i
+		w.AddWorkerClass("qemu64")
+	}
+	for _, g := range groups {
+		for i := 1; i <= workers; i++ {
+			t := tc.NewTest(fmt.Sprintf("%s%d", g, i))
+			t.AddWorkerClass("qemu64")
+			t.SetGroup(g)
+		}
+	}
+
+	s := NewScheduler(wc, tc)
+	s.AllowPending = true
+	return s
+}
+
+func TestGroupQuota(t *testing.T) {
+	s := groupScheduler(3, "kernel")
+	s.SetGroupQuota("kernel", 1)
+
+	if _, err := s.ScheduleDecode(); err != nil {
+		t.Fatal(err)
+	}
+	usage := s.Groups["kernel"]
+	if usage.Assigned != 1 || usage.Pending != 2 || usage.Quota != 1 {
+		t.Error("Group quota not enforced", usage)
+	}
+
+	running := encoder.NewTest("running")
+	running.AddWorkerClass("qemu64")
+	running.SetGroup("kernel")
+	s.InitialState = []*decoder.Assignment{decoder.NewAssignment(running, s.WorkerCollection.Workers[0], common.STATE_CURRENT, true)}
+	if _, err := s.ScheduleDecode(); err != nil {
+		t.Fatal(err)
+	}
+	if usage := s.Groups["kernel"]; usage.Running != 1 || usage.Pending != 3 {
+		t.Error("Running tests not counted in group quota", usage)
+	}
+
+	// Above its quota, a group only gets no new workers
+	running2 := encoder.NewTest("running2")
+	running2.AddWorkerClass("qemu64")
+	running2.SetGroup("kernel")
+	s.InitialState = append(s.InitialState, decoder.NewAssignment(running2, s.WorkerCollection.Workers[1], common.STATE_CURRENT, true))
+	other := s.TestCollection.NewTest("other")
+	other.AddWorkerClass("qemu64")
+	for _, preemption := range []bool{false, true} {
+		s.Preemption = preemption
+		if _, err := s.ScheduleDecode(); err != nil {
+			t.Fatal("Group over quota blocks the schedule:", err)
+		}
+		if usage := s.Groups["kernel"]; usage.Running != 2 || usage.Assigned != 0 || s.Groups[""].Assigned != 1 {
+			t.Error("Group over quota not handled", usage, s.Groups[""])
+		}
+	}
+}
+
+func TestGroupShare(t *testing.T) {
+	s := groupScheduler(4, "kernel", "desktop")
+	s.SetGroupShare("kernel", 1)
+	s.SetGroupShare("desktop", 1)
+
+	if _, err := s.ScheduleDecode(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Groups["kernel"].Assigned != 2 || s.Groups["desktop"].Assigned != 2 {
+		t.Error("Workers not shared between groups", s.Groups["kernel"], s.Groups["desktop"])
+	}
+
+	s.SetGroupShare("kernel", 3)
+	if _, err := s.ScheduleDecode(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Groups["kernel"].Assigned != 3 || s.Groups["desktop"].Assigned != 1 {
+		t.Error("Workers not shared by weight", s.Groups["kernel"], s.Groups["desktop"])
+	}
+
+	// Without competition a group can use all the workers
+	s = groupScheduler(4, "kernel")
+	s.SetGroupShare("kernel", 1)
+	s.SetGroupShare("desktop", 1)
+	if _, err := s.ScheduleDecode(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Groups["kernel"].Assigned != 4 {
+		t.Error("Idle share not used", s.Groups["kernel"])
+	}
+}
+
+func TestGroupUsageRunning(t *testing.T) {
+	s := groupScheduler(2, "kernel")
+	w := s.WorkerCollection.Workers[0]
+	running := &encoder.Test{Name: "desktop1", Group: "desktop"}
+	s.InitialState = []*decoder.Assignment{
+		decoder.NewAssignment(running, w, common.STATE_CURRENT, true),
+		{Worker: s.WorkerCollection.Workers[1], State: common.STATE_CURRENT, Value: true},
+	}
+	model := map[string]bool{s.InitialState[0].Encode(): true}
+
+	// The running test isn't queued, its group is taken from the assignment
+	groups := s.GroupUsage(model)
+	if groups["desktop"] == nil || groups["desktop"].Running != 1 || len(groups) != 2 {
+		t.Error("Wrong group usage", groups)
+	}
+	if running, _ := s.groupAssignments("desktop", ""); len(running) != 1 {
+		t.Error("Running assignment of the group not found", running)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"github.com/crillab/gophersat/bf"
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// SetHostCapacity caps the number of tests that can run at the same time
+// on the worker instances of host, counting the ones already running.
+func (s *Scheduler) SetHostCapacity(host string, capacity int) {
+	if s.HostCapacity == nil {
+		s.HostCapacity = make(map[string]int)
+	}
+	s.HostCapacity[host] = capacity
+}
+
+func (s *Scheduler) hostPolicy(t *encoder.Test) string {
+	if t.HostPolicy != "" {
+		return t.HostPolicy
+	}
+	if s.HostPolicy != "" {
+		return s.HostPolicy
+	}
+	return common.HOST_POLICY_ANY
+}
+
+// runningOnHost returns the assignments of the initial state running on host
+func (s *Scheduler) runningOnHost(host string) []bf.Formula {
+	var running []bf.Formula
+	for _, a := range s.InitialState {
+		if !a.Value || a.Worker == nil {
+			continue
+		}
+		if s.resolveWorker(a.Worker).GetHost() == host {
+			running = append(running, bf.Var(a.Encode()))
+		}
+	}
+	return running
+}
+
+// BuildHostFormula returns the constraints over worker hosts: host capacities
+// and the placement of parallel clusters according to their host policy.
+func (s *Scheduler) BuildHostFormula() bf.Formula {
+	f := bf.True
+	hosts := s.WorkerCollection.Hosts()
+
+	for _, host := range sortedKeys(s.HostCapacity) {
+		var vars []bf.Formula
+		for _, w := range hosts[host] {
+			for _, t := range s.TestCollection.Tests {
+				if s.canRun(w, t) {
+					vars = append(vars, bf.Var(s.Assign(w, t)))
+				}
+			}
+		}
+		f = and(f, s.atMostRunning(common.HostCapacityPrefix+host, s.HostCapacity[host], s.runningOnHost(host), vars))
+	}
+
+	for _, t := range s.TestCollection.Tests {
+		policy := s.hostPolicy(t)
+		if policy == common.HOST_POLICY_ANY {
+			continue
+		}
+		for _, p := range t.Parallel {
+			if peer := s.TestCollection.FindTest(p); peer != nil {
+				f = and(f, s.colocate(t, peer, policy == common.HOST_POLICY_SPREAD, nil))
+			}
+		}
+	}
+
+	return f
+}
+
+// colocate returns the constraints placing the test a on the same host of b,
+// or on a different one if apart is set. If violation is given, the
+// constraints don't need to hold but violation is set when they don't.
+func (s *Scheduler) colocate(a, b *encoder.Test, apart bool, violation bf.Formula) bf.Formula {
+	f := bf.True
+	hosts := s.WorkerCollection.Hosts()
+
+	for _, w := range s.WorkerCollection.Workers {
+		if !s.canRun(w, a) {
+			continue
+		}
+		not_assigned := bf.Not(bf.Var(s.Assign(w, a)))
+
+		// Placements of b available on the same host of w
+		var same []bf.Formula
+		for _, w2 := range hosts[w.GetHost()] {
+			if w2 != w && s.canRun(w2, b) {
+				same = append(same, bf.Var(s.Assign(w2, b)))
+			}
+		}
+
+		if apart {
+			for _, v := range same {
+				clause := []bf.Formula{not_assigned, bf.Not(v)}
+				if violation != nil {
+					clause = append(clause, violation)
+				}
+				f = and(f, bf.Or(clause...))
+			}
+			continue
+		}
+		clause := append([]bf.Formula{not_assigned}, same...)
+		if violation != nil {
+			clause = append(clause, violation)
+		}
+		f = and(f, bf.Or(clause...))
+	}
+
+	return f
+}
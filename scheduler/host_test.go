@@ -0,0 +1,193 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/crillab/gophersat/bf"
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func assignedHosts(ass []*decoder.Assignment, workers *encoder.WorkerColl) map[string]string {
+	hosts := make(map[string]string)
+	for _, a := range ass {
+		if a.Value {
+			hosts[a.Test.Name] = workers.FindWorker(a.Worker.Name, a.Worker.Instance).GetHost()
+		}
+	}
+	return hosts
+}
+
+func TestAtMost(t *testing.T) {
+	vars := []bf.Formula{bf.Var("a"), bf.Var("b"), bf.Var("c"), bf.Var("d")}
+
+	if bf.Solve(bf.And(atMost("c", 2, vars...), vars[0], vars[1], vars[2])) != nil {
+		t.Error("Three vars true with at most two allowed")
+	}
+	if bf.Solve(bf.And(atMost("c", 2, vars...), vars[0], vars[3])) == nil {
+		t.Error("Two vars true with at most two allowed")
+	}
+	if bf.Solve(bf.And(atMost("c", 0, vars...), vars[1])) != nil {
+		t.Error("One var true with none allowed")
+	}
+	if atMost("c", 4, vars...) != bf.True {
+		t.Error("Constraint not needed")
+	}
+}
+
+func TestHostCapacity(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	for i := 1; i <= 2; i++ {
+		w := workers.NewWorker("host1")
+		w.Instance = i
+		w.AddWorkerClass("qemu64")
+	}
+	w3 := workers.NewWorker("w3")
+	w3.SetHost("host2")
+	w3.AddWorkerClass("qemu64")
+
+	tests.NewTest("t1").AddWorkerClass("qemu64")
+	tests.NewTest("t2").AddWorkerClass("qemu64")
+
+	s := NewScheduler(workers, tests)
+	s.SetHostCapacity("host1", 1)
+	ass, err := s.ScheduleDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := assignedHosts(ass, workers)
+	if hosts["t1"] == hosts["t2"] {
+		t.Error("Host capacity exceeded", hosts)
+	}
+
+	tests.NewTest("t3").AddWorkerClass("qemu64")
+	_, err = s.ScheduleDecode()
+	if err == nil {
+		t.Error("Three tests fit on two slots")
+	}
+}
+
+func TestHostCapacityRunning(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	w1 := workers.NewWorker("host1")
+	w1.Instance = 1
+	w1.AddWorkerClass("qemu64")
+	w2 := workers.NewWorker("host1")
+	w2.Instance = 2
+	w2.AddWorkerClass("qemu64")
+
+	running := encoder.NewTest("running")
+	running.AddWorkerClass("qemu64")
+	tests.NewTest("t1").AddWorkerClass("qemu64")
+
+	s := NewScheduler(workers, tests)
+	s.SetHostCapacity("host1", 1)
+	s.InitialState = []*decoder.Assignment{decoder.NewAssignment(running, w1, common.STATE_CURRENT, true)}
+	if _, err := s.ScheduleDecode(); err == nil {
+		t.Error("Running test not counted in host capacity")
+	}
+}
+
+func TestHostOverCapacity(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	var state []*decoder.Assignment
+	for i := 1; i <= 3; i++ {
+		w := workers.NewWorker("host1")
+		w.Instance = i
+		w.AddWorkerClass("qemu64")
+		if i < 3 {
+			running := &encoder.Test{Name: fmt.Sprintf("running%d", i), WorkerClass: []string{"qemu64"}}
+			state = append(state, decoder.NewAssignment(running, w, common.STATE_CURRENT, true))
+		}
+	}
+	w4 := workers.NewWorker("w4")
+	w4.SetHost("host2")
+	w4.AddWorkerClass("qemu64")
+
+	tests.NewTest("t1").AddWorkerClass("qemu64")
+	tests.NewTest("t2").AddWorkerClass("qemu64")
+
+	s := NewScheduler(workers, tests)
+	s.SetHostCapacity("host1", 1)
+	s.InitialState = state
+	s.AllowPending = true
+	res, err := s.Plan()
+	if err != nil {
+		t.Fatal("Host over capacity blocks the schedule:", err)
+	}
+	if len(res.Unchanged) != 2 {
+		t.Error("Running tests not kept", res.Unchanged)
+	}
+	if len(res.Assigned) != 1 || res.Assigned[0].Worker.GetHost() != "host2" {
+		t.Error("Expected a single test assigned on host2", res.Assigned)
+	}
+	if len(res.Pending) != 1 {
+		t.Error("Expected a single pending test", res.Pending)
+	}
+}
+
+func TestHostPolicy(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	for _, h := range []string{"host1", "host2"} {
+		for i := 1; i <= 2; i++ {
+			w := workers.NewWorker(h)
+			w.Instance = i
+			w.AddWorkerClass("qemu64")
+		}
+	}
+
+	server := tests.NewTest("server")
+	server.AddWorkerClass("qemu64")
+	server.AddParallel("client")
+	client := tests.NewTest("client")
+	client.AddWorkerClass("qemu64")
+
+	s := NewScheduler(workers, tests)
+	for i := 0; i < 5; i++ {
+		s.HostPolicy = common.HOST_POLICY_SAME
+		ass, err := s.ScheduleDecode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts := assignedHosts(ass, workers)
+		if hosts["server"] != hosts["client"] {
+			t.Error("Cluster spread across hosts", hosts)
+		}
+
+		server.SetHostPolicy(common.HOST_POLICY_SPREAD)
+		ass, err = s.ScheduleDecode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts = assignedHosts(ass, workers)
+		if hosts["server"] == hosts["client"] {
+			t.Error("Cluster not spread across hosts", hosts)
+		}
+		server.SetHostPolicy("")
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// LevelTrace is below slog.LevelDebug, and logs the pre-filter decision of
+// every worker and test pair
+const LevelTrace = slog.LevelDebug - 4
+
+// NewLogger returns a structured logger writing text records of at least
+// level to w, suitable for Scheduler.Logger
+func NewLogger(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// discardHandler drops every record, disabled at all levels so that
+// nothing is formatted
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// discard is the logger of the schedulers without Logger
+var discard = slog.New(discardHandler{})
+
+// logger returns s.Logger, or a logger discarding everything if unset
+func (s *Scheduler) logger() *slog.Logger {
+	if s.Logger == nil {
+		return discard
+	}
+	return s.Logger
+}
+
+// tracePrefilter logs why w is or isn't a candidate for t
+func (s *Scheduler) tracePrefilter(l *slog.Logger, w *encoder.Worker, t *encoder.Test, ok bool) {
+	if !l.Enabled(context.Background(), LevelTrace) {
+		return
+	}
+	reason := "accepted"
+	switch {
+	case !w.AcceptsJobs():
+		reason = "worker " + w.Status
+	case len(t.WorkerClass) > 0 && !s.Classes.Matches(w, t):
+		reason = "worker class mismatch"
+	case !s.Classes.Satisfies(w, t):
+		reason = "requirements not met"
+	case s.WaitingForParent(t):
+		reason = "waiting for parent " + t.Parent
+	}
+	l.Log(context.Background(), LevelTrace, "pre-filter",
+		"worker", w.Encode(), "test", t.Name, "candidate", ok, "reason", reason)
+}
+
+func statsAttrs(stats *SolverStats) []any {
+	if stats == nil {
+		return nil
+	}
+	return []any{
+		"variables", stats.Variables,
+		"clauses", stats.Clauses,
+		"penalties", stats.Penalties,
+		"cost", stats.Cost,
+		"solves", stats.Solves,
+		"conflicts", stats.Conflicts,
+		"restarts", stats.Restarts,
+		"decisions", stats.Decisions,
+		"learned", stats.Learned,
+	}
+}
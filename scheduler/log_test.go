@@ -0,0 +1,81 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func loggedScheduler(level slog.Level) (*Scheduler, *bytes.Buffer) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	workers.NewWorker("mudler").AddWorkerClass("developer")
+	boss := workers.NewWorker("boss")
+	boss.AddWorkerClass("developer")
+	boss.SetStatus(common.WORKER_DRAINING)
+	workers.NewWorker("intern").AddWorkerClass("intern")
+
+	tests.NewTest("lunch").AddWorkerClass("developer")
+
+	var buf bytes.Buffer
+	s := NewScheduler(workers, tests)
+	s.Logger = NewLogger(&buf, level)
+	return s, &buf
+}
+
+func TestLogger(t *testing.T) {
+	s, buf := loggedScheduler(slog.LevelInfo)
+	if _, err := s.ScheduleDecode(); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, msg := range []string{"building formula", "formula built", "formula solved", "conflicts=", "learned=", "model decoded", "assignments=1"} {
+		if !strings.Contains(out, msg) {
+			t.Error("Missing log", msg, out)
+		}
+	}
+	if strings.Contains(out, "level=DEBUG") || strings.Contains(out, "pre-filter") {
+		t.Error("Logged above verbosity", out)
+	}
+
+	s, buf = loggedScheduler(LevelTrace)
+	if _, err := s.ScheduleDecode(); err != nil {
+		t.Fatal(err)
+	}
+	out = buf.String()
+	for _, msg := range []string{"encoded test", "reason=\"worker draining\"", "reason=\"worker class mismatch\"", "reason=accepted", "msg=assignment"} {
+		if !strings.Contains(out, msg) {
+			t.Error("Missing log", msg, out)
+		}
+	}
+
+	s, _ = loggedScheduler(slog.LevelInfo)
+	s.Logger = nil
+	if _, err := s.ScheduleDecode(); err != nil {
+		t.Fatal("Scheduling without logger failed", err)
+	}
+	if s.logger() != NewScheduler(nil, nil).logger() || s.logger().Enabled(context.Background(), slog.LevelError) {
+		t.Error("Expected the schedulers without logger to share a disabled one")
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// Snapshot is the state of the workers and tests at the start of a tick
+type Snapshot struct {
+	Workers *encoder.WorkerColl
+	// Tests are the queued tests
+	Tests *encoder.TestColl
+	// Running are the assignments running on the workers
+	Running []*decoder.Assignment
+}
+
+// Provider returns the workers and tests to schedule at each tick
+type Provider interface {
+	Snapshot(ctx context.Context) (*Snapshot, error)
+}
+
+// Dispatcher hands the assignments over to the workers. Dispatch returns once
+// the assignment is acknowledged, or an error if it isn't.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, a *decoder.Assignment) error
+}
+
+// Revoker is implemented by the dispatchers able to take an acknowledged
+// assignment back. The loop revokes the members of a parallel cluster
+// dispatched before another member failed.
+type Revoker interface {
+	Revoke(ctx context.Context, a *decoder.Assignment) error
+}
+
+// DispatchFailure is an assignment the dispatcher didn't acknowledge, or a
+// member of the parallel cluster of one
+type DispatchFailure struct {
+	Assignment *decoder.Assignment
+	Attempts   int
+	Err        error
+}
+
+// TickResult is the outcome of a tick of the loop
+type TickResult struct {
+	// Plan is the schedule computed, nil if the tick failed before solving
+	Plan *ScheduleResult
+	// Committed are the assignments acknowledged by the dispatcher
+	Committed []*decoder.Assignment
+	// Failed are the assignments left queued for the next tick. Parallel
+	// clusters fail as a whole.
+	Failed []*DispatchFailure
+}
+
+// Loop schedules the tests of a provider in rounds, on an interval or when
+// triggered, and pushes the new assignments to a dispatcher. Assignments
+// are committed to the state of the loop only once acknowledged, so that
+// the next rounds keep their workers busy until the provider reports them
+// running. Parallel clusters are dispatched as a unit: if a member fails,
+// none of the cluster is committed. Preemption isn't supported, running
+// assignments are never revoked.
+//
+// Ticks are serialized, calling Tick while Run is running waits for the
+// current tick. The configuration of the scheduler must not be changed
+// while the loop runs.
+type Loop struct {
+	// Scheduler is the configuration of the schedules, its collections and
+	// initial state are replaced at each tick
+	Scheduler  *Scheduler
+	Provider   Provider
+	Dispatcher Dispatcher
+
+	// Interval between ticks, ticks only happen when triggered if zero
+	Interval time.Duration
+	// Retries is the number of times a failed dispatch is retried within a
+	// tick, afterwards the test is scheduled again at the next tick
+	Retries int
+	// RetryDelay is the wait before retrying a dispatch
+	RetryDelay time.Duration
+
+	// OnCommit, if set, is called for every acknowledged assignment
+	OnCommit func(a *decoder.Assignment)
+	// OnTick, if set, is called after every tick run by Run
+	OnTick func(res *TickResult, err error)
+
+	// ticking is held during a tick, as it replaces the collections of
+	// the scheduler
+	ticking   sync.Mutex
+	mu        sync.Mutex
+	committed []*decoder.Assignment
+	trigger   chan struct{}
+}
+
+func NewLoop(s *Scheduler, p Provider, d Dispatcher) *Loop {
+	return &Loop{Scheduler: s, Provider: p, Dispatcher: d, trigger: make(chan struct{}, 1)}
+}
+
+// Trigger asks for a tick as soon as possible, e.g. when a job is queued
+// or a worker comes up. Triggers coalesce while a tick is waiting.
+func (l *Loop) Trigger() {
+	select {
+	case l.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Committed returns the acknowledged assignments the provider doesn't report
+// as running yet
+func (l *Loop) Committed() []*decoder.Assignment {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*decoder.Assignment{}, l.committed...)
+}
+
+// Run ticks at once, then on every interval or trigger until ctx is done, and
+// returns its error. Failing ticks don't stop the loop, they are reported to
+// OnTick.
+func (l *Loop) Run(ctx context.Context) error {
+	var tick <-chan time.Time
+	if l.Interval > 0 {
+		ticker := time.NewTicker(l.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		res, err := l.Tick(ctx)
+		if l.OnTick != nil {
+			l.OnTick(res, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick:
+		case <-l.trigger:
+		}
+	}
+}
+
+// Tick runs a round: it takes a snapshot from the provider, schedules it
+// along with the committed assignments, and dispatches the new assignments.
+// The search for the plan stops when ctx is done, then nothing is
+// dispatched, or when the SolveTimeout of the scheduler expires, then the
+// cheapest plan found is.
+func (l *Loop) Tick(ctx context.Context) (*TickResult, error) {
+	l.ticking.Lock()
+	defer l.ticking.Unlock()
+
+	res := &TickResult{}
+	s := l.Scheduler
+	if s.Preemption {
+		return res, errors.New("Loop error: preemption is not supported")
+	}
+	snap, err := l.Provider.Snapshot(ctx)
+	if err != nil {
+		return res, err
+	}
+
+	l.mu.Lock()
+	tests, state := l.reconcile(snap)
+	l.mu.Unlock()
+	s.WorkerCollection, s.TestCollection, s.InitialState = snap.Workers, tests, state
+
+	res.Plan, err = s.PlanContext(ctx)
+	if err != nil {
+		return res, err
+	}
+	if err := ctx.Err(); err != nil {
+		return res, err
+	}
+	log := s.logger()
+	for _, cluster := range clusters(res.Plan.Assigned) {
+		if failed := l.dispatchCluster(ctx, cluster); failed != nil {
+			for _, f := range failed {
+				log.Warn("dispatch failed", "test", f.Assignment.Test.Name, "worker", f.Assignment.Worker.Encode(), "attempts", f.Attempts, "error", f.Err)
+			}
+			res.Failed = append(res.Failed, failed...)
+			continue
+		}
+		l.mu.Lock()
+		l.committed = append(l.committed, cluster...)
+		l.mu.Unlock()
+		res.Committed = append(res.Committed, cluster...)
+		if l.OnCommit != nil {
+			for _, a := range cluster {
+				l.OnCommit(a)
+			}
+		}
+	}
+	log.Info("tick done", "committed", len(res.Committed), "failed", len(res.Failed), "pending", len(res.Plan.Pending))
+	return res, ctx.Err()
+}
+
+// clusters splits the assignments into their parallel clusters, in the
+// order of their first member
+func clusters(ass []*decoder.Assignment) [][]*decoder.Assignment {
+	index := make(map[string]int)
+	for i, a := range ass {
+		index[a.Test.Name] = i
+	}
+	// cluster maps each assignment to the first one of its cluster
+	cluster := make([]int, len(ass))
+	for i := range cluster {
+		cluster[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if cluster[i] != i {
+			cluster[i] = root(cluster[i])
+		}
+		return cluster[i]
+	}
+	for i, a := range ass {
+		for _, p := range a.Test.Parallel {
+			if j, ok := index[p]; ok {
+				x, y := root(i), root(j)
+				if x > y {
+					x, y = y, x
+				}
+				cluster[y] = x
+			}
+		}
+	}
+
+	var res [][]*decoder.Assignment
+	pos := make(map[int]int)
+	for i, a := range ass {
+		r := root(i)
+		if _, ok := pos[r]; !ok {
+			pos[r] = len(res)
+			res = append(res, nil)
+		}
+		res[pos[r]] = append(res[pos[r]], a)
+	}
+	return res
+}
+
+// dispatchCluster dispatches the assignments of a parallel cluster, and
+// returns a failure for each of them if one fails. The members after the
+// failing one aren't dispatched, the ones before are revoked if the
+// dispatcher can.
+func (l *Loop) dispatchCluster(ctx context.Context, cluster []*decoder.Assignment) []*DispatchFailure {
+	failed := make([]*DispatchFailure, len(cluster))
+	for i, a := range cluster {
+		attempts, err := l.dispatch(ctx, a)
+		failed[i] = &DispatchFailure{Assignment: a, Attempts: attempts, Err: err}
+		if err == nil {
+			continue
+		}
+		peerErr := fmt.Errorf("Dispatch error: parallel peer %s failed", a.Test.Name)
+		for _, f := range failed[:i] {
+			f.Err = peerErr
+			if r, ok := l.Dispatcher.(Revoker); ok {
+				if err := r.Revoke(ctx, f.Assignment); err != nil {
+					f.Err = fmt.Errorf("%v, revoking: %v", peerErr, err)
+				}
+			}
+		}
+		for j := i + 1; j < len(cluster); j++ {
+			failed[j] = &DispatchFailure{Assignment: cluster[j], Err: peerErr}
+		}
+		return failed
+	}
+	return nil
+}
+
+// reconcile returns the tests to schedule and the initial state from the
+// snapshot and the committed assignments. A committed assignment is dropped
+// once the provider reports its test running, or neither running nor queued
+// as it's finished then, or once its worker is gone. While the provider
+// still reports its test queued, the test isn't scheduled again.
+func (l *Loop) reconcile(snap *Snapshot) (*encoder.TestColl, []*decoder.Assignment) {
+	running := make(map[string]bool)
+	for _, a := range snap.Running {
+		running[a.Test.Name] = true
+	}
+	state := append([]*decoder.Assignment{}, snap.Running...)
+	dispatched := make(map[string]bool)
+	var kept []*decoder.Assignment
+	for _, a := range l.committed {
+		if running[a.Test.Name] || snap.Tests.FindTest(a.Test.Name) == nil {
+			continue
+		}
+		w := snap.Workers.FindWorker(a.Worker.Name, a.Worker.Instance)
+		if w == nil {
+			continue
+		}
+		a = decoder.NewAssignment(a.Test, w, common.STATE_CURRENT, true)
+		kept = append(kept, a)
+		state = append(state, a)
+		dispatched[a.Test.Name] = true
+	}
+	l.committed = kept
+
+	tests := encoder.NewTestColl()
+	for _, t := range snap.Tests.Tests {
+		if !dispatched[t.Name] {
+			tests.AddTest(t)
+		}
+	}
+	return tests, state
+}
+
+// dispatch hands a over to the dispatcher, retrying on failures, and
+// returns the number of attempts
+func (l *Loop) dispatch(ctx context.Context, a *decoder.Assignment) (int, error) {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = l.Dispatcher.Dispatch(ctx, a); err == nil || attempt > l.Retries {
+			return attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(l.RetryDelay):
+		}
+	}
+}
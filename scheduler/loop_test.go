@@ -0,0 +1,284 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// fakeProvider reports queued tests, and running tests by worker name
+type fakeProvider struct {
+	workers []string
+	queued  []string
+	running map[string]string
+	// parallel maps queued tests to their parallel peers
+	parallel map[string][]string
+}
+
+func (p *fakeProvider) Snapshot(ctx context.Context) (*Snapshot, error) {
+	snap := &Snapshot{Workers: encoder.NewWorkerColl(), Tests: encoder.NewTestColl()}
+	for _, name := range p.workers {
+		snap.Workers.NewWorker(name).AddWorkerClass("developer")
+	}
+	for _, name := range p.queued {
+		t := snap.Tests.NewTest(name)
+		t.AddWorkerClass("developer")
+		for _, peer := range p.parallel[name] {
+			t.AddParallel(peer)
+		}
+	}
+	for test, worker := range p.running {
+		t := &encoder.Test{Name: test, WorkerClass: []string{"developer"}}
+		w := snap.Workers.FindWorker(worker, 0)
+		snap.Running = append(snap.Running, decoder.NewAssignment(t, w, common.STATE_CURRENT, true))
+	}
+	return snap, nil
+}
+
+// start moves a queued test to running
+func (p *fakeProvider) start(test, worker string) {
+	for i, name := range p.queued {
+		if name == test {
+			p.queued = append(p.queued[:i], p.queued[i+1:]...)
+			break
+		}
+	}
+	p.running[test] = worker
+}
+
+// fakeDispatcher fails the first dispatches of some tests
+type fakeDispatcher struct {
+	failures   map[string]int
+	dispatched []string
+	revoked    []string
+}
+
+func (d *fakeDispatcher) Dispatch(ctx context.Context, a *decoder.Assignment) error {
+	if d.failures[a.Test.Name] > 0 {
+		d.failures[a.Test.Name]--
+		return errors.New("worker unreachable")
+	}
+	d.dispatched = append(d.dispatched, a.Test.Name+"="+a.Worker.Name)
+	return nil
+}
+
+func (d *fakeDispatcher) Revoke(ctx context.Context, a *decoder.Assignment) error {
+	d.revoked = append(d.revoked, a.Test.Name+"="+a.Worker.Name)
+	return nil
+}
+
+func testNames(ass []*decoder.Assignment) string {
+	var names []string
+	for _, a := range ass {
+		names = append(names, a.Test.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestLoop(t *testing.T) {
+	p := &fakeProvider{workers: []string{"mudler", "mudler_away"}, queued: []string{"cook", "lunch", "coffee"}, running: map[string]string{}}
+	d := &fakeDispatcher{}
+	s := NewScheduler(nil, nil)
+	s.AllowPending = true
+	l := NewLoop(s, p, d)
+	var commits []string
+	l.OnCommit = func(a *decoder.Assignment) { commits = append(commits, a.Test.Name) }
+
+	res, err := l.Tick(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Committed) != 2 || len(d.dispatched) != 2 || len(commits) != 2 || len(res.Plan.Pending) != 1 {
+		t.Fatal("Expected two assignments committed", res.Committed, res.Plan.Pending)
+	}
+	first := testNames(res.Committed)
+	workerOf := make(map[string]string)
+	for _, a := range res.Committed {
+		workerOf[a.Test.Name] = a.Worker.Name
+	}
+
+	// The provider still reports the dispatched tests queued
+	if res, err = l.Tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Committed) != 0 || len(d.dispatched) != 2 || testNames(l.Committed()) != first {
+		t.Error("Committed assignments dispatched again", d.dispatched)
+	}
+
+	// Now they run
+	for test, worker := range workerOf {
+		p.start(test, worker)
+	}
+	if res, err = l.Tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Committed) != 0 || len(l.Committed()) != 0 {
+		t.Error("Expected the running assignments to replace the committed ones", l.Committed())
+	}
+
+	// One of them finished
+	for test := range workerOf {
+		delete(p.running, test)
+		break
+	}
+	if res, err = l.Tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Committed) != 1 || strings.Contains(first, res.Committed[0].Test.Name) {
+		t.Error("Expected the last test assigned", res.Committed)
+	}
+}
+
+func TestLoopRetries(t *testing.T) {
+	p := &fakeProvider{workers: []string{"mudler"}, queued: []string{"lunch"}, running: map[string]string{}}
+	d := &fakeDispatcher{failures: map[string]int{"lunch": 3}}
+	l := NewLoop(NewScheduler(nil, nil), p, d)
+	l.Retries = 1
+
+	res, err := l.Tick(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Committed) != 0 || len(res.Failed) != 1 || res.Failed[0].Attempts != 2 || len(l.Committed()) != 0 {
+		t.Fatal("Expected the dispatch to fail after a retry", res.Failed)
+	}
+
+	// Scheduled again at the next tick
+	if res, err = l.Tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Committed) != 1 || len(res.Failed) != 0 || len(l.Committed()) != 1 {
+		t.Error("Expected the dispatch to succeed on retry", res.Failed)
+	}
+
+	l.Scheduler.Preemption = true
+	if _, err := l.Tick(context.Background()); err == nil {
+		t.Error("Preemption accepted")
+	}
+}
+
+func TestLoopParallel(t *testing.T) {
+	p := &fakeProvider{
+		workers:  []string{"mudler", "mudler_away", "intern"},
+		queued:   []string{"client", "server", "lunch"},
+		running:  map[string]string{},
+		parallel: map[string][]string{"client": {"server"}, "server": {"client"}},
+	}
+	// Assignments are dispatched by test name, the client goes first
+	d := &fakeDispatcher{failures: map[string]int{"server": 1}}
+	l := NewLoop(NewScheduler(nil, nil), p, d)
+
+	res, err := l.Tick(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testNames(res.Committed) != "lunch" || testNames(l.Committed()) != "lunch" {
+		t.Error("Expected only lunch committed", res.Committed)
+	}
+	var failed []*decoder.Assignment
+	for _, f := range res.Failed {
+		failed = append(failed, f.Assignment)
+		if f.Err == nil {
+			t.Error("Failure without error", f.Assignment.Test.Name)
+		}
+	}
+	if testNames(failed) != "client,server" {
+		t.Error("Expected the parallel cluster to fail as a whole", failed)
+	}
+	if len(d.revoked) != 1 || !strings.HasPrefix(d.revoked[0], "client=") {
+		t.Error("Expected the dispatched client revoked", d.revoked)
+	}
+
+	// The whole cluster is scheduled again at the next tick
+	if res, err = l.Tick(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if testNames(res.Committed) != "client,server" || len(res.Failed) != 0 {
+		t.Error("Expected the parallel cluster committed", res.Committed, res.Failed)
+	}
+}
+
+func TestLoopRun(t *testing.T) {
+	p := &fakeProvider{workers: []string{"mudler"}, queued: []string{"lunch"}, running: map[string]string{}}
+	l := NewLoop(NewScheduler(nil, nil), p, &fakeDispatcher{})
+	ticks := make(chan *TickResult)
+	l.OnTick = func(res *TickResult, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		ticks <- res
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Run(ctx) }()
+
+	// The first tick happens at once, then no interval, ticks happen when
+	// triggered only
+	if res := <-ticks; len(res.Committed) != 1 {
+		t.Error("Expected lunch committed", res.Committed)
+	}
+	select {
+	case <-ticks:
+		t.Fatal("Tick without trigger")
+	case <-time.After(10 * time.Millisecond):
+	}
+	l.Trigger()
+	if res := <-ticks; len(res.Committed) != 0 {
+		t.Error("Expected lunch committed once", res.Committed)
+	}
+
+	// Ticks run by hand wait for the ones of Run
+	l.Trigger()
+	if _, err := l.Tick(ctx); err != nil {
+		t.Error(err)
+	}
+	<-ticks
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Error("Expected the loop canceled", err)
+	}
+}
+
+func TestLoopCanceled(t *testing.T) {
+	p := &fakeProvider{workers: []string{"mudler"}, queued: []string{"lunch"}, running: map[string]string{}}
+	d := &fakeDispatcher{}
+	l := NewLoop(NewScheduler(nil, nil), p, d)
+	l.Scheduler.SolveTimeout = time.Nanosecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Tick(ctx); err != context.Canceled || len(d.dispatched) != 0 {
+		t.Error("Expected nothing dispatched after cancellation", d.dispatched, err)
+	}
+
+	// The timeout only cuts the search for a cheaper plan
+	res, err := l.Tick(context.Background())
+	if err != nil || len(res.Committed) != 1 {
+		t.Error("Expected lunch committed within the timeout", res.Committed, err)
+	}
+}
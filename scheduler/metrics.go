@@ -0,0 +1,170 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// MetricsHook is notified with the result of every Plan run
+type MetricsHook interface {
+	ObserveSchedule(res *ScheduleResult, err error)
+}
+
+// SolveBuckets are the upper bounds, in seconds, of the solve duration histogram
+var SolveBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30}
+
+// Metrics collects scheduling runs and exports them in the Prometheus text
+// format. It is safe for concurrent use, and serves the metrics over HTTP.
+type Metrics struct {
+	mu sync.Mutex
+
+	runs      map[string]int
+	variables int
+	clauses   int
+
+	solveBuckets []int
+	solveCount   int
+	solveSum     float64
+
+	assigned map[string]int
+	pending  map[string]int
+	idle     int
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		runs:         make(map[string]int),
+		solveBuckets: make([]int, len(SolveBuckets)),
+		assigned:     make(map[string]int),
+		pending:      make(map[string]int),
+	}
+}
+
+// workerClass is the label identifying the worker classes a test needs
+func workerClass(t *encoder.Test) string {
+	return strings.Join(t.WorkerClass, ",")
+}
+
+func (m *Metrics) ObserveSchedule(res *ScheduleResult, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case err == nil:
+		m.runs[common.RUN_SAT]++
+	case res != nil && res.Stats != nil && res.Stats.Solves > 0 && res.Stats.Cost < 0:
+		m.runs[common.RUN_UNSAT]++
+	default:
+		m.runs[common.RUN_ERROR]++
+	}
+	if res == nil {
+		return
+	}
+
+	if res.Stats != nil {
+		m.variables = res.Stats.Variables
+		m.clauses = res.Stats.Clauses
+	}
+	secs := res.SolveTime.Seconds()
+	for i, b := range SolveBuckets {
+		if secs <= b {
+			m.solveBuckets[i]++
+		}
+	}
+	m.solveCount++
+	m.solveSum += secs
+
+	// Gauges describe the last run only
+	m.assigned = make(map[string]int)
+	m.pending = make(map[string]int)
+	for _, a := range res.Assigned {
+		m.assigned[workerClass(a.Test)]++
+	}
+	for _, p := range res.Pending {
+		m.pending[workerClass(p.Test)]++
+	}
+	m.idle = len(res.IdleWorkers)
+}
+
+func writeLabeled(w io.Writer, name, label string, values map[string]int) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, k, values[k])
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "# HELP openqa_scheduler_runs_total Scheduling runs by result.")
+	fmt.Fprintln(&buf, "# TYPE openqa_scheduler_runs_total counter")
+	for _, r := range []string{common.RUN_SAT, common.RUN_UNSAT, common.RUN_ERROR} {
+		fmt.Fprintf(&buf, "openqa_scheduler_runs_total{result=%q} %d\n", r, m.runs[r])
+	}
+
+	fmt.Fprintln(&buf, "# HELP openqa_scheduler_formula_variables Variables of the last formula.")
+	fmt.Fprintln(&buf, "# TYPE openqa_scheduler_formula_variables gauge")
+	fmt.Fprintf(&buf, "openqa_scheduler_formula_variables %d\n", m.variables)
+	fmt.Fprintln(&buf, "# HELP openqa_scheduler_formula_clauses Clauses of the last formula.")
+	fmt.Fprintln(&buf, "# TYPE openqa_scheduler_formula_clauses gauge")
+	fmt.Fprintf(&buf, "openqa_scheduler_formula_clauses %d\n", m.clauses)
+
+	fmt.Fprintln(&buf, "# HELP openqa_scheduler_solve_duration_seconds Time spent solving formulas.")
+	fmt.Fprintln(&buf, "# TYPE openqa_scheduler_solve_duration_seconds histogram")
+	for i, b := range SolveBuckets {
+		fmt.Fprintf(&buf, "openqa_scheduler_solve_duration_seconds_bucket{le=\"%g\"} %d\n", b, m.solveBuckets[i])
+	}
+	fmt.Fprintf(&buf, "openqa_scheduler_solve_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.solveCount)
+	fmt.Fprintf(&buf, "openqa_scheduler_solve_duration_seconds_sum %g\n", m.solveSum)
+	fmt.Fprintf(&buf, "openqa_scheduler_solve_duration_seconds_count %d\n", m.solveCount)
+
+	fmt.Fprintln(&buf, "# HELP openqa_scheduler_tests_assigned Tests assigned by the last run per worker class.")
+	fmt.Fprintln(&buf, "# TYPE openqa_scheduler_tests_assigned gauge")
+	writeLabeled(&buf, "openqa_scheduler_tests_assigned", "worker_class", m.assigned)
+	fmt.Fprintln(&buf, "# HELP openqa_scheduler_tests_pending Tests left pending by the last run per worker class.")
+	fmt.Fprintln(&buf, "# TYPE openqa_scheduler_tests_pending gauge")
+	writeLabeled(&buf, "openqa_scheduler_tests_pending", "worker_class", m.pending)
+
+	fmt.Fprintln(&buf, "# HELP openqa_scheduler_idle_workers Online workers left idle by the last run.")
+	fmt.Fprintln(&buf, "# TYPE openqa_scheduler_idle_workers gauge")
+	fmt.Fprintf(&buf, "openqa_scheduler_idle_workers %d\n", m.idle)
+
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP exports the metrics, so that Metrics can be mounted as the
+// /metrics handler scraped by Prometheus
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
@@ -0,0 +1,84 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func TestMetrics(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	workers.NewWorker("mudler").AddWorkerClass("developer")
+	workers.NewWorker("intern").AddWorkerClass("intern")
+
+	tests.NewTest("lunch").AddWorkerClass("developer")
+	tests.NewTest("dinner").AddWorkerClass("developer")
+
+	m := NewMetrics()
+	s := NewScheduler(workers, tests)
+	s.Metrics = m
+	s.AllowPending = true
+	if _, err := s.Plan(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.AllowPending = false
+	if _, err := s.Plan(); err == nil {
+		t.Fatal("Two tests assigned to one worker")
+	}
+
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Error("Wrong content type", resp.Header.Get("Content-Type"))
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, l := range []string{
+		`openqa_scheduler_runs_total{result="sat"} 1`,
+		`openqa_scheduler_runs_total{result="unsat"} 1`,
+		`openqa_scheduler_runs_total{result="error"} 0`,
+		`openqa_scheduler_solve_duration_seconds_count 2`,
+		`openqa_scheduler_tests_pending{worker_class="developer"} 2`,
+		`openqa_scheduler_idle_workers 0`,
+		"# TYPE openqa_scheduler_solve_duration_seconds histogram",
+	} {
+		if !strings.Contains(string(body), l+"\n") {
+			t.Error("Missing metric", l)
+		}
+	}
+	if strings.Contains(string(body), "openqa_scheduler_formula_variables 0\n") {
+		t.Error("Formula size not exported")
+	}
+	if strings.Contains(string(body), "openqa_scheduler_tests_assigned{") {
+		t.Error("Assigned tests of the failed run exported")
+	}
+}
@@ -0,0 +1,426 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/crillab/gophersat/bf"
+	"github.com/crillab/gophersat/solver"
+)
+
+// AddPenalty adds weight to the cost of the solution when the variable v is true.
+// Penalties are collected while building the formula, and Solve looks for the
+// model with the lowest cost when there are any.
+func (s *Scheduler) AddPenalty(v string, weight int) {
+	if weight <= 0 {
+		return
+	}
+	if s.penalties == nil {
+		s.penalties = make(map[string]int)
+	}
+	s.penalties[v] += weight
+}
+
+// SolverStats are statistics about solving a formula
+type SolverStats struct {
+	Variables int `json:"variables"`
+	Clauses   int `json:"clauses"`
+	Penalties int `json:"penalties"`
+	// Cost is the sum of the penalties of the model, -1 if there is none
+	Cost int `json:"cost"`
+	// Optimal is false if the search for a cheaper model was cut short
+	Optimal bool `json:"optimal"`
+	// Solves is how many times the solver ran looking for the cheapest model
+	Solves    int `json:"solves"`
+	Conflicts int `json:"conflicts"`
+	Restarts  int `json:"restarts"`
+	Decisions int `json:"decisions"`
+	Learned   int `json:"learned"`
+}
+
+// cnf is the DIMACS form of a formula, along with the index of its named variables
+type cnf struct {
+	nbVars  int
+	vars    map[string]int
+	clauses [][]int
+
+	// undecided and values are the clauses after propagating their units,
+	// see propagated
+	undecided [][]int
+	values    []int8
+}
+
+func toCnf(f bf.Formula) (*cnf, error) {
+	var buf bytes.Buffer
+	if err := bf.Dimacs(f, &buf); err != nil {
+		return nil, err
+	}
+
+	c := &cnf{vars: make(map[string]int)}
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "p "):
+			if fields := strings.Fields(line); len(fields) == 4 {
+				c.nbVars, _ = strconv.Atoi(fields[2])
+			}
+		case strings.HasPrefix(line, "c "):
+			sep := strings.LastIndex(line, "=")
+			if sep < 0 {
+				return nil, errors.New("Malformed DIMACS variable: " + line)
+			}
+			idx, err := strconv.Atoi(line[sep+1:])
+			if err != nil {
+				return nil, err
+			}
+			c.vars[line[2:sep]] = idx
+		default:
+			clause := make([]int, 0)
+			for _, field := range strings.Fields(line) {
+				lit, err := strconv.Atoi(field)
+				if err != nil {
+					return nil, err
+				}
+				if lit != 0 {
+					clause = append(clause, lit)
+				}
+			}
+			c.clauses = append(c.clauses, clause)
+		}
+	}
+
+	return c, scanner.Err()
+}
+
+// FormulaStats returns the size of f once converted to CNF, without solving it
+func FormulaStats(f bf.Formula) (*SolverStats, error) {
+	c, err := toCnf(f)
+	if err != nil {
+		return nil, err
+	}
+	return &SolverStats{Variables: c.nbVars, Clauses: len(c.clauses), Cost: -1}, nil
+}
+
+// minimize solves f looking for the model where the sum of the weights of the
+// true penalty variables is the lowest. It returns a nil model if f is unsatisfiable.
+// low is a lower bound of the cost known beforehand, 0 if there is none, and
+// guess are values of variables to try first, hopefully reaching it.
+//
+// The optimal cost is searched by bisection, solving the problem again with
+// an upper bound on the cost each time, as solver.Minimize can't cope with
+// bounds that propagate more than one unit at once. If a bounded solve fails,
+// or ctx is done, the cheapest model found so far is returned and isn't
+// marked optimal. gophersat can't be interrupted: ctx is only checked
+// between solves, a solve in progress runs to its end, and the first one
+// always runs.
+func minimize(ctx context.Context, f bf.Formula, penalties map[string]int, low int, guess map[string]bool) (map[string]bool, *SolverStats, error) {
+	stats := &SolverStats{Cost: -1}
+	c, err := toCnf(f)
+	if err != nil {
+		return nil, stats, err
+	}
+	stats.Variables = c.nbVars
+	stats.Clauses = len(c.clauses)
+
+	var lits, weights []int
+	for _, v := range sortedKeys(penalties) {
+		if idx, ok := c.vars[v]; ok {
+			lits = append(lits, idx)
+			weights = append(weights, penalties[v])
+		}
+	}
+	stats.Penalties = len(lits)
+
+	var units []int
+	for v, value := range guess {
+		if idx, ok := c.vars[v]; ok && value {
+			units = append(units, idx)
+		} else if ok {
+			units = append(units, -idx)
+		}
+	}
+	best, cost, err := c.solve(lits, weights, -1, units, stats)
+	if err == nil && best == nil && len(units) > 0 {
+		best, cost, err = c.solve(lits, weights, -1, nil, stats)
+	}
+	if err != nil {
+		return nil, stats, err
+	}
+	if best == nil {
+		return nil, stats, nil
+	}
+	stats.Optimal = true
+	for low < cost {
+		if ctx.Err() != nil {
+			stats.Optimal = false
+			break
+		}
+		bound := (low + cost - 1) / 2
+		m, k, err := c.solve(lits, weights, bound, nil, stats)
+		if err != nil {
+			stats.Optimal = false
+			break
+		}
+		if m != nil {
+			best, cost = m, k
+		} else {
+			low = bound + 1
+		}
+	}
+	stats.Cost = cost
+
+	model := make(map[string]bool)
+	for v, idx := range c.vars {
+		model[v] = idx <= len(best) && best[idx-1]
+	}
+	return model, stats, nil
+}
+
+// solverLock serializes the solves. gophersat keeps scratch buffers in
+// package variables, bufLits when learning clauses and alloc when allocating
+// them, so concurrent solves, e.g. Loop ticks and dry runs in the same
+// process, corrupt each other's learned clauses.
+var solverLock sync.Mutex
+
+// solve returns a model of the cnf and its cost, or a nil model if there is
+// none. If bound is not negative, only models costing at most bound are
+// accepted, and units are assumed true. Solver panics are returned as errors.
+//
+// gophersat can report satisfiable bounds as unsatisfiable when literals are
+// assigned before the search starts, by unit clauses or by weights above the
+// bound. These are assigned here instead, so that the solver only gets the
+// clauses left undecided.
+func (c *cnf) solve(lits, weights []int, bound int, units []int, stats *SolverStats) (m []bool, cost int, err error) {
+	solverLock.Lock()
+	defer solverLock.Unlock()
+	defer func() {
+		if r := recover(); r != nil {
+			m, cost, err = nil, -1, fmt.Errorf("Solver failure: %v", r)
+		}
+	}()
+	stats.Solves++
+
+	clauses, values, ok := c.propagated()
+	if ok && len(units) > 0 {
+		clauses, values, ok = propagate(clauses, values, units)
+	}
+	var bounded []solver.PBConstr
+	for ok && bound >= 0 {
+		var l, w []int
+		left := bound
+		for i, x := range lits {
+			switch values[x] {
+			case 1:
+				left -= weights[i]
+			case 0:
+				l = append(l, x)
+				w = append(w, weights[i])
+			}
+		}
+		var over []int
+		for i := range l {
+			if w[i] > left {
+				over = append(over, -l[i])
+			}
+		}
+		if left < 0 {
+			ok = false
+		} else if len(over) == 0 {
+			if len(l) > 0 {
+				bounded = append(bounded, solver.LtEq(l, w, left))
+			}
+			break
+		} else {
+			clauses, values, ok = propagate(clauses, values, over)
+		}
+	}
+	if !ok {
+		return nil, -1, nil
+	}
+
+	constrs := make([]solver.PBConstr, 0, len(clauses)+len(bounded))
+	for _, clause := range clauses {
+		constrs = append(constrs, solver.PropClause(clause...))
+	}
+	constrs = append(constrs, bounded...)
+
+	m = make([]bool, c.nbVars)
+	if len(constrs) > 0 {
+		sol := solver.New(solver.ParsePBConstrs(constrs))
+		status := sol.Solve()
+		stats.Conflicts += sol.Stats.NbConflicts
+		stats.Restarts += sol.Stats.NbRestarts
+		stats.Decisions += sol.Stats.NbDecisions
+		stats.Learned += sol.Stats.NbLearned
+		if status != solver.Sat {
+			return nil, -1, nil
+		}
+		copy(m, sol.Model())
+	}
+	for v := 1; v <= c.nbVars; v++ {
+		if values[v] != 0 {
+			m[v-1] = values[v] > 0
+		}
+	}
+	for i, idx := range lits {
+		if idx <= len(m) && m[idx-1] {
+			cost += weights[i]
+		}
+	}
+	return m, cost, nil
+}
+
+// propagated returns the clauses left undecided once their units are
+// propagated, and the values of the variables, or false if they conflict
+func (c *cnf) propagated() ([][]int, []int8, bool) {
+	if c.values == nil {
+		var ok bool
+		if c.undecided, c.values, ok = propagate(c.clauses, make([]int8, c.nbVars+1), nil); !ok {
+			c.values = []int8{}
+		}
+	}
+	return c.undecided, c.values, len(c.values) > 0
+}
+
+// propagate assigns the literals of units, and of the clauses left with a
+// single undecided literal, in a copy of values indexed by variable: 1 for
+// true, -1 for false. It returns the clauses still undecided, without their
+// false literals, and the values, or false on a conflict. Duplicate
+// literals and tautologies are dropped.
+func propagate(clauses [][]int, values []int8, units []int) ([][]int, []int8, bool) {
+	values = append([]int8{}, values...)
+	value := func(l int) int8 {
+		if l < 0 {
+			return -values[-l]
+		}
+		return values[l]
+	}
+
+	// mark holds the index of the last clause seen with each variable, signed
+	// as the literal
+	mark := make([]int, len(values))
+	occurs := make([][]int, len(values))
+	queue := append([]int{}, units...)
+	var kept [][]int
+	for i, clause := range clauses {
+		n := i + 1
+		lits := make([]int, 0, len(clause))
+		tautology := false
+		for _, l := range clause {
+			v, signed := l, n
+			if l < 0 {
+				v, signed = -l, -n
+			}
+			if mark[v] == signed {
+				continue
+			}
+			if mark[v] == -signed {
+				tautology = true
+				break
+			}
+			mark[v] = signed
+			lits = append(lits, l)
+		}
+		switch {
+		case tautology:
+		case len(lits) == 0:
+			return nil, nil, false
+		case len(lits) == 1:
+			queue = append(queue, lits[0])
+		default:
+			for _, l := range lits {
+				v := l
+				if v < 0 {
+					v = -v
+				}
+				occurs[v] = append(occurs[v], len(kept))
+			}
+			kept = append(kept, lits)
+		}
+	}
+
+	done := make([]bool, len(kept))
+	for len(queue) > 0 {
+		l := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		switch value(l) {
+		case 1:
+			continue
+		case -1:
+			return nil, nil, false
+		}
+		v := l
+		if l < 0 {
+			v = -l
+			values[v] = -1
+		} else {
+			values[v] = 1
+		}
+		for _, i := range occurs[v] {
+			if done[i] {
+				continue
+			}
+			undecided, last, sat := 0, 0, false
+			for _, x := range kept[i] {
+				switch value(x) {
+				case 1:
+					sat = true
+				case 0:
+					undecided++
+					last = x
+				}
+				if sat {
+					break
+				}
+			}
+			switch {
+			case sat:
+				done[i] = true
+			case undecided == 0:
+				return nil, nil, false
+			case undecided == 1:
+				done[i] = true
+				queue = append(queue, last)
+			}
+		}
+	}
+
+	var rest [][]int
+	for i, clause := range kept {
+		if done[i] {
+			continue
+		}
+		lits := clause[:0:0]
+		for _, l := range clause {
+			if value(l) == 0 {
+				lits = append(lits, l)
+			}
+		}
+		rest = append(rest, lits)
+	}
+	return rest, values, true
+}
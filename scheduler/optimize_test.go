@@ -0,0 +1,280 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/crillab/gophersat/bf"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func TestMinimize(t *testing.T) {
+	f := bf.And(bf.Or(bf.Var("a"), bf.Var("b")), bf.Or(bf.Var("b"), bf.Var("c")))
+
+	model, stats, err := minimize(context.Background(), f, map[string]int{"b": 5, "a": 1, "c": 1}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Variables != 3 || stats.Clauses != 2 || stats.Penalties != 3 || stats.Solves < 2 {
+		t.Error("Wrong solver statistics", stats)
+	}
+	if stats.Cost != 2 || model["b"] || !model["a"] || !model["c"] {
+		t.Error("Not the cheapest model", model, stats.Cost)
+	}
+
+	model, stats, err = minimize(context.Background(), f, map[string]int{"b": 1, "a": 1, "c": 1}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Cost != 1 || !model["b"] {
+		t.Error("Not the cheapest model", model, stats.Cost)
+	}
+
+	model, stats, err = minimize(context.Background(), bf.And(bf.Var("a"), bf.Not(bf.Var("a"))), map[string]int{"a": 1}, 0, nil)
+	if err != nil || model != nil || stats.Cost != -1 {
+		t.Error("Unsatisfiable formula solved", model, err)
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// cheapest returns the lowest cost of the models of the cnf, found by trying
+// every assignment, or -1 if there is none
+func cheapest(c *cnf, lits, weights []int) int {
+	best := -1
+	for a := 0; a < 1<<uint(c.nbVars); a++ {
+		sat := true
+		for _, clause := range c.clauses {
+			ok := false
+			for _, l := range clause {
+				if (a>>uint(abs(l)-1)&1 == 1) == (l > 0) {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				sat = false
+				break
+			}
+		}
+		if !sat {
+			continue
+		}
+		cost := 0
+		for i, l := range lits {
+			if a>>uint(l-1)&1 == 1 {
+				cost += weights[i]
+			}
+		}
+		if best < 0 || cost < best {
+			best = cost
+		}
+	}
+	return best
+}
+
+// A bound on the cost must never make a satisfiable problem look unsatisfiable,
+// or minimize returns a model it claims optimal while a cheaper one exists
+func TestMinimizeOptimal(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		c := &cnf{nbVars: 4 + r.Intn(7)}
+		for j := 0; j < 2*c.nbVars; j++ {
+			var clause []int
+			for k := 0; k < 1+r.Intn(3); k++ {
+				l := 1 + r.Intn(c.nbVars)
+				if r.Intn(2) == 0 {
+					l = -l
+				}
+				clause = append(clause, l)
+			}
+			c.clauses = append(c.clauses, clause)
+		}
+		var lits, weights []int
+		for l := 1; l <= c.nbVars; l++ {
+			if r.Intn(3) > 0 {
+				lits = append(lits, l)
+				weights = append(weights, 1+r.Intn(20))
+			}
+		}
+
+		want := cheapest(c, lits, weights)
+		stats := &SolverStats{}
+		m, cost, err := c.solve(lits, weights, want, nil, stats)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (m == nil) != (want < 0) || m != nil && cost > want {
+			t.Fatalf("Clauses %v, weights %v: cost %d, cheapest %d", c.clauses, weights, cost, want)
+		}
+	}
+}
+
+func TestSolveDuplicateUnits(t *testing.T) {
+	// solver.New makes room for as many units as variables only, and panics
+	// on more, duplicates included
+	c := &cnf{nbVars: 1, clauses: [][]int{{1}, {1}, {1}}}
+	m, _, err := c.solve([]int{1}, []int{1}, 1, nil, &SolverStats{})
+	if err != nil || len(m) != 1 || !m[0] {
+		t.Error("Duplicate units not solved", m, err)
+	}
+}
+
+func TestPropagate(t *testing.T) {
+	// 1 and 2 follow from the units, 3 and 4 stay undecided
+	clauses := [][]int{{1}, {-1, 2}, {-2, 3, 4, 4}, {3, -3}, {1, 1}}
+	rest, values, ok := propagate(clauses, make([]int8, 5), nil)
+	if !ok || values[1] != 1 || values[2] != 1 || values[3] != 0 || values[4] != 0 {
+		t.Fatal("Wrong values", values, ok)
+	}
+	if len(rest) != 1 || len(rest[0]) != 2 || rest[0][0] != 3 || rest[0][1] != 4 {
+		t.Error("Wrong undecided clauses", rest)
+	}
+
+	if rest, values, ok = propagate(rest, values, []int{-3}); !ok || values[4] != 1 || len(rest) != 0 {
+		t.Error("Units not propagated", rest, values)
+	}
+	if _, _, ok = propagate(clauses, make([]int8, 5), []int{-2}); ok {
+		t.Error("Conflict not found")
+	}
+}
+
+// BenchmarkMinimizePending plans queues longer than the workers: every
+// bounded solve has to prove which tests are left pending
+func BenchmarkMinimizePending(b *testing.B) {
+	for _, size := range []struct{ workers, tests int }{{4, 6}, {6, 8}, {10, 12}, {10, 20}} {
+		b.Run(fmt.Sprintf("%dw-%dt", size.workers, size.tests), func(b *testing.B) {
+			var res *ScheduleResult
+			for i := 0; i < b.N; i++ {
+				tests := encoder.NewTestColl()
+				workers := encoder.NewWorkerColl()
+				for j := 0; j < size.workers; j++ {
+					workers.NewWorker(fmt.Sprintf("worker%d", j)).AddWorkerClass("qemu_x86_64")
+				}
+				for j := 0; j < size.tests; j++ {
+					t := tests.NewTest(fmt.Sprintf("job%d", j))
+					t.AddWorkerClass("qemu_x86_64")
+					t.SetPriority(j % 5 * 10)
+				}
+				s := NewScheduler(workers, tests)
+				s.AllowPending = true
+				var err error
+				if res, err = s.Plan(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if !res.Stats.Optimal || len(res.Pending) != size.tests-size.workers {
+				b.Error("Wrong plan", res.Stats, res.Pending)
+			}
+			b.ReportMetric(float64(res.Stats.Solves), "solves")
+			b.ReportMetric(float64(res.Stats.Conflicts), "conflicts")
+		})
+	}
+}
+
+// expiring is a context done after its error is checked n times
+type expiring struct {
+	context.Context
+	n int
+}
+
+func (c *expiring) Err() error {
+	if c.n--; c.n < 0 {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func TestMinimizeBudget(t *testing.T) {
+	f := bf.And(bf.Or(bf.Var("a"), bf.Var("b")), bf.Or(bf.Var("b"), bf.Var("c")))
+	penalties := map[string]int{"b": 5, "a": 1, "c": 1}
+
+	model, stats, err := minimize(&expiring{Context: context.Background()}, f, penalties, 0, nil)
+	if err != nil || model == nil {
+		t.Fatal("No model found before the budget", model, err)
+	}
+	if stats.Optimal || stats.Solves != 1 {
+		t.Error("Expected the first model, not optimal", stats)
+	}
+
+	_, stats, err = minimize(&expiring{Context: context.Background(), n: 100}, f, penalties, 0, nil)
+	if err != nil || !stats.Optimal || stats.Cost != 2 {
+		t.Error("Budget cut the search short", stats, err)
+	}
+}
+
+// gophersat keeps scratch buffers in package variables, concurrent solves
+// must not corrupt each other's learned clauses
+func TestConcurrentSolves(t *testing.T) {
+	// random 3-SAT near the threshold, where the solver learns many clauses
+	problems := make([]*cnf, 8)
+	for i := range problems {
+		r := rand.New(rand.NewSource(int64(i)))
+		c := &cnf{nbVars: 80}
+		for j := 0; j < 340; j++ {
+			var clause []int
+			for k := 0; k < 3; k++ {
+				l := 1 + r.Intn(c.nbVars)
+				if r.Intn(2) == 0 {
+					l = -l
+				}
+				clause = append(clause, l)
+			}
+			c.clauses = append(c.clauses, clause)
+		}
+		problems[i] = c
+	}
+	type result struct {
+		sat       bool
+		conflicts int
+		err       error
+	}
+	solve := func(c *cnf) result {
+		stats := &SolverStats{}
+		m, _, err := c.solve(nil, nil, -1, nil, stats)
+		return result{m != nil, stats.Conflicts, err}
+	}
+
+	results := make([]result, len(problems))
+	var wg sync.WaitGroup
+	for i := range problems {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = solve(problems[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i, res := range results {
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		if expected := solve(problems[i]); res != expected {
+			t.Error("Solve", i, "differs from the sequential one", res, expected)
+		}
+	}
+}
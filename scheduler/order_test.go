@@ -0,0 +1,92 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// goldenScheduler returns a scheduler with several equally good schedules,
+// where only the ordering decides which one is picked
+func goldenScheduler() *Scheduler {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	for _, name := range []string{"w1", "w2", "w3", "w4"} {
+		w := workers.NewWorker(name)
+		w.AddWorkerClass("qemu64")
+		if name < "w3" {
+			w.SetHost("openqaworker1")
+		} else {
+			w.SetHost("openqaworker2")
+		}
+	}
+	for i, name := range []string{"t1", "t2", "t3", "t4", "t5", "t6"} {
+		t := tests.NewTest(name)
+		t.AddWorkerClass("qemu64")
+		t.SetGroup([]string{"sle", "tumbleweed", "leap"}[i%3])
+	}
+
+	s := NewScheduler(workers, tests)
+	s.AllowPending = true
+	s.SetHostCapacity("openqaworker1", 1)
+	s.SetGroupQuota("sle", 1)
+	s.SetGroupShare("tumbleweed", 1)
+	s.SetGroupShare("leap", 1)
+	return s
+}
+
+func TestDeterministicPlan(t *testing.T) {
+	var first []byte
+	for i := 0; i < 10; i++ {
+		res, err := goldenScheduler().Plan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.BuildTime, res.SolveTime, res.DecodeTime = 0, 0, 0
+		data, err := res.JSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = data
+		} else if !bytes.Equal(first, data) {
+			t.Fatal("Same input scheduled differently", string(first), string(data))
+		}
+	}
+
+	golden := filepath.Join("testdata", "plan.golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, first, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, first) {
+		t.Error("Schedule doesn't match", golden, string(first))
+	}
+}
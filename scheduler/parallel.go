@@ -0,0 +1,51 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"github.com/crillab/gophersat/bf"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// BuildParallelFormula returns the constraints keeping the parallel cluster
+// of t together: t can only be assigned if each of its parallel peers is.
+// Peers missing from the test collection are running already, and left out.
+func (s *Scheduler) BuildParallelFormula(t *encoder.Test) bf.Formula {
+	f := bf.True
+	for _, p := range t.Parallel {
+		peer := s.TestCollection.FindTest(p)
+		if peer == nil {
+			continue
+		}
+		var peerVars []bf.Formula
+		for _, w := range s.WorkerCollection.Workers {
+			if s.canRun(w, peer) {
+				peerVars = append(peerVars, bf.Var(s.Assign(w, peer)))
+			}
+		}
+		for _, w := range s.WorkerCollection.Workers {
+			if !s.canRun(w, t) {
+				continue
+			}
+			if len(peerVars) == 0 {
+				f = and(f, bf.Not(bf.Var(s.Assign(w, t))))
+			} else {
+				f = and(f, bf.Implies(bf.Var(s.Assign(w, t)), bf.Or(peerVars...)))
+			}
+		}
+	}
+	return f
+}
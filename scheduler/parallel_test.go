@@ -0,0 +1,102 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func TestParallelCluster(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	workers.NewWorker("mudler").AddWorkerClass("developer")
+	workers.NewWorker("mudler_away").AddWorkerClass("developer")
+	server := tests.NewTest("server")
+	server.AddWorkerClass("developer")
+	server.AddParallel("client")
+	client := tests.NewTest("client")
+	client.AddWorkerClass("manager")
+	client.AddParallel("server")
+
+	// The client can't be assigned, so neither can the server
+	s := NewScheduler(workers, tests)
+	if _, err := s.ScheduleDecode(); err == nil {
+		t.Error("Parallel cluster assigned partially")
+	}
+
+	client.WorkerClass = []string{"developer"}
+	ass, err := s.ScheduleDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assigned := 0
+	for _, a := range ass {
+		if a.Value {
+			assigned++
+		}
+	}
+	if assigned != 2 {
+		t.Error("Parallel cluster not assigned", ass)
+	}
+}
+
+func TestParallelClusterPending(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	workers.NewWorker("mudler").AddWorkerClass("developer")
+	workers.NewWorker("mudler_away").AddWorkerClass("developer")
+	cluster := []string{"server", "client1", "client2"}
+	for _, name := range cluster {
+		test := tests.NewTest(name)
+		test.AddWorkerClass("developer")
+		for _, peer := range cluster {
+			if peer != name {
+				test.AddParallel(peer)
+			}
+		}
+	}
+	tests.NewTest("lunch").AddWorkerClass("developer")
+
+	// Three peers don't fit two workers, none of them is assigned
+	s := NewScheduler(workers, tests)
+	s.AllowPending = true
+	res, err := s.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Assigned) != 1 || res.Assigned[0].Test.Name != "lunch" || len(res.Pending) != 3 {
+		t.Error("Parallel cluster assigned partially", res.Assigned, res.Pending)
+	}
+
+	// Peers running already are left out of the constraints
+	server := tests.Tests[0]
+	tests.Tests = tests.Tests[1:]
+	busy := workers.NewWorker("mudler_busy")
+	busy.AddWorkerClass("developer")
+	s.InitialState = []*decoder.Assignment{decoder.NewAssignment(server, busy, common.STATE_CURRENT, true)}
+	if res, err = s.Plan(); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Assigned) != 2 || len(res.Pending) != 1 || res.Pending[0].Test.Name != "lunch" {
+		t.Error("Expected the peers left assigned", res.Assigned, res.Pending)
+	}
+}
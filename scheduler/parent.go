@@ -0,0 +1,36 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import "github.com/mudler/openqa-scheduler-go/encoder"
+
+// WaitingForParent returns true if the parent of t didn't finish yet: it is
+// still queued in the test collection, or running in the initial state.
+// Tests can't start before their parent is done.
+func (s *Scheduler) WaitingForParent(t *encoder.Test) bool {
+	if t.Parent == "" {
+		return false
+	}
+	if s.TestCollection.FindTest(t.Parent) != nil {
+		return true
+	}
+	for _, a := range s.InitialState {
+		if a.Value && a.Test != nil && a.Test.Name == t.Parent {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func TestParent(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	w1 := workers.NewWorker("mudler")
+	w1.AddWorkerClass("developer")
+	workers.NewWorker("mudler_away").AddWorkerClass("developer")
+
+	tests.NewTest("cook").AddWorkerClass("developer")
+	lunch := tests.NewTest("lunch")
+	lunch.AddWorkerClass("developer")
+	lunch.SetParent("cook")
+
+	s := NewScheduler(workers, tests)
+	ass, err := s.ScheduleDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range ass {
+		if a.Value && a.Test == lunch {
+			t.Fatal("Test assigned along with its parent", a.Worker)
+		}
+	}
+
+	s.AllowPending = true
+	res, err := s.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Assigned) != 1 || res.Assigned[0].Test.Name != "cook" {
+		t.Error("Expected only the parent assigned", res.Assigned)
+	}
+	if len(res.Pending) != 1 || res.Pending[0].Test != lunch || res.Pending[0].Reason != common.PENDING_PARENT {
+		t.Error("Expected the child waiting for its parent", res.Pending)
+	}
+
+	// The parent is running now
+	cook := tests.Tests[0]
+	tests.Tests = tests.Tests[1:]
+	s.InitialState = []*decoder.Assignment{decoder.NewAssignment(cook, w1, common.STATE_CURRENT, true)}
+	if res, err = s.Plan(); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Assigned) != 0 || len(res.Pending) != 1 {
+		t.Error("Test assigned while its parent is running", res.Assigned)
+	}
+
+	// The parent is done
+	s.InitialState = nil
+	if res, err = s.Plan(); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Assigned) != 1 || res.Assigned[0].Test != lunch {
+		t.Error("Test not assigned after its parent finished", res.Assigned)
+	}
+}
+
+func TestParentDone(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	w := workers.NewWorker("mudler")
+	w.AddWorkerClass("developer")
+	lunch := tests.NewTest("lunch")
+	lunch.AddWorkerClass("developer")
+	lunch.SetParent("cook")
+
+	// Assignments of the initial state which aren't running don't hold
+	// their children back
+	cook := encoder.NewTest("cook")
+	s := NewScheduler(workers, tests)
+	s.InitialState = []*decoder.Assignment{decoder.NewAssignment(cook, w, common.STATE_CURRENT, false)}
+	if s.WaitingForParent(lunch) {
+		t.Error("Waiting for a parent which isn't running")
+	}
+	res, err := s.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Assigned) != 1 || res.Assigned[0].Test != lunch {
+		t.Error("Test not assigned after its parent finished", res.Assigned)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/crillab/gophersat/bf"
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// PendingWeight is the penalty for leaving a test of priority 0 pending
+const PendingWeight = 100
+
+// pendingWeight returns the penalty paid for leaving t pending: the more
+// urgent the test, the more it costs not to schedule it. It is only paid
+// with AllowPending, so the aging and deadline bonuses it adds have no
+// effect without it: every test is assigned then, or the schedule fails.
+func (s *Scheduler) pendingWeight(t *encoder.Test) int {
+	w := PendingWeight + s.EffectivePriority(t) + s.deadlineBonus(t)
+	if w < 1 {
+		return 1
+	}
+	return w
+}
+
+// Pending returns the variable holding when t is left pending
+func (s *Scheduler) Pending(t *encoder.Test) bf.Formula {
+	return bf.Var(s.TaskState(t, common.STATE_PENDING))
+}
+
+// BuildPendingFormula returns the constraints of a pending test: it is not
+// assigned to any worker, and neither is the rest of its parallel cluster.
+func (s *Scheduler) BuildPendingFormula(t *encoder.Test) bf.Formula {
+	f := bf.True
+	for _, w := range s.WorkerCollection.Workers {
+		if s.canRun(w, t) {
+			f = and(f, bf.Implies(s.Pending(t), bf.Not(bf.Var(s.Assign(w, t)))))
+		}
+	}
+	for _, p := range t.Parallel {
+		if peer := s.TestCollection.FindTest(p); peer != nil {
+			f = and(f, bf.Eq(s.Pending(t), s.Pending(peer)))
+		}
+	}
+	return f
+}
+
+// capacity is a set of workers able to run the same tests
+type capacity struct {
+	workers map[string]bool
+	// tests are the tests only these workers can run
+	tests []*encoder.Test
+}
+
+// capacities returns the distinct sets of workers able to run each test of
+// the collection
+func (s *Scheduler) capacities() []*capacity {
+	candidates := make([]map[string]bool, len(s.TestCollection.Tests))
+	seen := make(map[string]bool)
+	var res []*capacity
+	for i, t := range s.TestCollection.Tests {
+		candidates[i] = make(map[string]bool)
+		var names []string
+		for _, w := range s.WorkerCollection.Workers {
+			if s.canRun(w, t) {
+				candidates[i][w.Encode()] = true
+				names = append(names, w.Encode())
+			}
+		}
+		key := strings.Join(names, ",")
+		if len(names) > 0 && !seen[key] {
+			seen[key] = true
+			res = append(res, &capacity{workers: candidates[i]})
+		}
+	}
+
+	for _, c := range res {
+		for i, t := range s.TestCollection.Tests {
+			only := len(candidates[i]) > 0
+			for w := range candidates[i] {
+				only = only && c.workers[w]
+			}
+			if only {
+				c.tests = append(c.tests, t)
+			}
+		}
+	}
+	return res
+}
+
+// runningOn returns the assignments of the initial state running on workers
+func (s *Scheduler) runningOn(workers map[string]bool) []bf.Formula {
+	var running []bf.Formula
+	for _, a := range s.InitialState {
+		if a.Value && a.Worker != nil && workers[s.resolveWorker(a.Worker).Encode()] {
+			running = append(running, bf.Var(a.Encode()))
+		}
+	}
+	return running
+}
+
+// BuildCapacityFormula returns, for the workers able to run each test, that
+// at most as many tests as those workers are left out of pending among the
+// tests only they can run, counting the assignments running on them. It is
+// implied by the rest of the formula, but spelled out as a counter it lets the
+// solver see at once that a queue doesn't fit its workers, which it would
+// otherwise prove trying every placement.
+func (s *Scheduler) BuildCapacityFormula() bf.Formula {
+	f := bf.True
+	if !s.AllowPending {
+		return f
+	}
+	for i, c := range s.capacities() {
+		var placed []bf.Formula
+		for _, t := range c.tests {
+			placed = append(placed, bf.Not(s.Pending(t)))
+		}
+		f = and(f, s.atMostRunning(common.WorkerCapacityPrefix+strconv.Itoa(i), len(c.workers), s.runningOn(c.workers), placed))
+	}
+	return f
+}
+
+// leastPending returns the tests left pending by the cheapest schedule
+// respecting only the number of workers able to run them, and its cost: the
+// tests no worker can run, and for the workers able to run the same tests,
+// the cheapest tests exceeding them. The cost is a lower bound of the
+// penalties paid for pending tests.
+func (s *Scheduler) leastPending() (int, []*encoder.Test) {
+	if !s.AllowPending {
+		return 0, nil
+	}
+
+	// merge the capacities sharing workers, as their tests compete for them
+	group := make(map[string]string)
+	var find func(w string) string
+	find = func(w string) string {
+		if group[w] == "" || group[w] == w {
+			return w
+		}
+		group[w] = find(group[w])
+		return group[w]
+	}
+	for _, c := range s.capacities() {
+		first := ""
+		for w := range c.workers {
+			if first == "" {
+				first = find(w)
+			} else if root := find(w); root != first {
+				group[root] = first
+			}
+		}
+	}
+
+	cost := 0
+	var pending []*encoder.Test
+	tests := make(map[string][]*encoder.Test)
+	for _, t := range s.TestCollection.Tests {
+		root := ""
+		for _, w := range s.WorkerCollection.Workers {
+			if s.canRun(w, t) {
+				root = find(w.Encode())
+				break
+			}
+		}
+		if root == "" {
+			cost += s.penalties[s.TaskState(t, common.STATE_PENDING)]
+			pending = append(pending, t)
+			continue
+		}
+		tests[root] = append(tests[root], t)
+	}
+
+	workers := make(map[string]map[string]bool)
+	for _, w := range s.WorkerCollection.Workers {
+		root := find(w.Encode())
+		if workers[root] == nil {
+			workers[root] = make(map[string]bool)
+		}
+		workers[root][w.Encode()] = true
+	}
+	for root, queue := range tests {
+		free := len(workers[root])
+		if !s.Preemption {
+			free -= len(s.runningOn(workers[root]))
+		}
+		if free < 0 {
+			free = 0
+		}
+		// the tests queued last are left pending first among equals
+		for i, j := 0, len(queue)-1; i < j; i, j = i+1, j-1 {
+			queue[i], queue[j] = queue[j], queue[i]
+		}
+		sort.SliceStable(queue, func(i, j int) bool {
+			return s.penalties[s.TaskState(queue[i], common.STATE_PENDING)] <
+				s.penalties[s.TaskState(queue[j], common.STATE_PENDING)]
+		})
+		for i := 0; i < len(queue)-free; i++ {
+			cost += s.penalties[s.TaskState(queue[i], common.STATE_PENDING)]
+			pending = append(pending, queue[i])
+		}
+	}
+	return cost, pending
+}
+
+// guessPending returns the cost of the tests left pending by leastPending,
+// and the values of the pending variables of all the tests
+func (s *Scheduler) guessPending() (int, map[string]bool) {
+	cost, pending := s.leastPending()
+	if !s.AllowPending {
+		return cost, nil
+	}
+	guess := make(map[string]bool)
+	for _, t := range s.TestCollection.Tests {
+		guess[s.TaskState(t, common.STATE_PENDING)] = false
+	}
+	for _, t := range pending {
+		guess[s.TaskState(t, common.STATE_PENDING)] = true
+	}
+	return cost, guess
+}
+
+// PendingTests returns the tests of the collection not assigned in model
+func (s *Scheduler) PendingTests(model map[string]bool) []*encoder.Test {
+	assigned := make(map[string]bool)
+	for _, a := range s.assignments(model) {
+		if a.Value {
+			assigned[a.Test.Name] = true
+		}
+	}
+
+	var pending []*encoder.Test
+	for _, t := range s.TestCollection.Tests {
+		if !assigned[t.Name] {
+			pending = append(pending, t)
+		}
+	}
+	return pending
+}
@@ -0,0 +1,156 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/crillab/gophersat/bf"
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func TestAllowPending(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	workers.NewWorker("mudler").AddWorkerClass("developer")
+	lunch := tests.NewTest("lunch")
+	lunch.AddWorkerClass("developer")
+	hiking := tests.NewTest("hiking")
+	hiking.AddWorkerClass("developer")
+	hiking.SetPriority(10)
+
+	s := NewScheduler(workers, tests)
+	if _, err := s.ScheduleDecode(); err == nil {
+		t.Fatal("Two tests assigned to a single worker")
+	}
+
+	s.AllowPending = true
+	model, _, err := s.Schedule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := s.PendingTests(model)
+	if len(pending) != 1 || pending[0] != lunch {
+		t.Error("Expected the less urgent test pending", pending)
+	}
+}
+
+func TestPendingCluster(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	workers.NewWorker("mudler").AddWorkerClass("developer")
+	server := tests.NewTest("server")
+	server.AddWorkerClass("developer")
+	server.AddParallel("client")
+	tests.NewTest("client").AddWorkerClass("developer")
+
+	s := NewScheduler(workers, tests)
+	s.AllowPending = true
+	model, _, err := s.Schedule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.PendingTests(model)) != 2 {
+		t.Error("Parallel cluster partially assigned", s.PendingTests(model))
+	}
+}
+
+func TestCapacityFormula(t *testing.T) {
+	s, high := busyWorkers(2)
+	s.WorkerCollection.NewWorker("spare").AddWorkerClass("qemu64")
+	s.TestCollection.NewTest("low").AddWorkerClass("qemu64")
+	if s.BuildCapacityFormula() != bf.True {
+		t.Error("Capacity constrained without pending tests")
+	}
+
+	s.AllowPending = true
+	model, _, err := s.Schedule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := s.PendingTests(model)
+	if len(pending) != 1 || pending[0].Name != "low" {
+		t.Error("Expected the less urgent test pending", pending)
+	}
+	if s.minCost != PendingWeight {
+		t.Error("Wrong lower bound", s.minCost)
+	}
+
+	// Running assignments free their workers when preempted
+	s.Preemption = true
+	res, err := s.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Pending) != 0 || len(res.Preempted) != 1 {
+		t.Error("Expected", high.Name, "to preempt a running test", res.Pending, res.Preempted)
+	}
+	if s.minCost != 0 {
+		t.Error("Wrong lower bound under preemption", s.minCost)
+	}
+}
+
+// The lower bound and the guess only speed up minimize, the cost reached must
+// be the one found without them
+func TestLeastPendingBound(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	classes := []string{"qemu_x86_64", "qemu_aarch64", "tap"}
+	for i := 0; i < 100; i++ {
+		tests := encoder.NewTestColl()
+		workers := encoder.NewWorkerColl()
+		s := NewScheduler(workers, tests)
+		s.AllowPending = true
+		s.Preemption = r.Intn(2) == 0
+
+		for j := 0; j < 2+r.Intn(3); j++ {
+			w := workers.NewWorker(fmt.Sprintf("worker%d", j))
+			w.AddWorkerClass(classes[r.Intn(2)])
+			if r.Intn(2) == 0 {
+				w.AddWorkerClass("tap")
+			}
+			if r.Intn(3) == 0 {
+				running := encoder.NewTest(fmt.Sprintf("running%d", j))
+				running.SetPriority(r.Intn(3) * 10)
+				s.InitialState = append(s.InitialState, decoder.NewAssignment(running, w, common.STATE_CURRENT, true))
+			}
+		}
+		for j := 0; j < 3+r.Intn(4); j++ {
+			test := tests.NewTest(fmt.Sprintf("job%d", j))
+			test.AddWorkerClass(classes[r.Intn(len(classes))])
+			test.SetPriority(r.Intn(3) * 10)
+		}
+
+		f := s.BuildFormula()
+		_, want, err := minimize(context.Background(), f, s.penalties, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, stats, err := minimize(context.Background(), f, s.penalties, s.minCost, s.guess)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.minCost > want.Cost || stats.Cost != want.Cost || !stats.Optimal {
+			t.Fatalf("Scenario %d: lower bound %d, cost %d, optimal cost %d", i, s.minCost, stats.Cost, want.Cost)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/crillab/gophersat/bf"
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+)
+
+// busyFormula returns the constraints for a worker running the assignment a
+// of the initial state: as long as a is kept, the worker gets no new tests.
+func (s *Scheduler) busyFormula(a *decoder.Assignment) bf.Formula {
+	w := s.resolveWorker(a.Worker)
+	f := bf.True
+	for _, t := range s.TestCollection.Tests {
+		if s.canRun(w, t) {
+			f = and(f, bf.Implies(bf.Var(a.Encode()), bf.Not(bf.Var(s.Assign(w, t)))))
+		}
+	}
+	return f
+}
+
+// preemptFormula returns the constraints for the i-th assignment of the
+// initial state when preemption is enabled: it is kept unless a test with a
+// strictly higher priority takes over its worker. Every preemption is penalized,
+// so the solver revokes as few running assignments as possible.
+func (s *Scheduler) preemptFormula(i int, a *decoder.Assignment) bf.Formula {
+	w := s.resolveWorker(a.Worker)
+	running := s.resolveTest(a.Test)
+
+	var higher []bf.Formula
+	for _, t := range s.TestCollection.Tests {
+		if t.Priority > running.Priority && s.canRun(w, t) {
+			higher = append(higher, bf.Var(s.Assign(w, t)))
+		}
+	}
+	if len(higher) == 0 {
+		return bf.Var(a.Encode())
+	}
+
+	p := fmt.Sprintf(common.PreemptFmt, i)
+	s.AddPenalty(p, 1)
+	return bf.And(
+		bf.Or(bf.Var(a.Encode()), bf.Var(p)),
+		bf.Or(append([]bf.Formula{bf.Var(a.Encode())}, higher...)...),
+	)
+}
+
+// PreemptedAssignments returns the running assignments of the initial state
+// revoked in model, which should be cancelled.
+func (s *Scheduler) PreemptedAssignments(model map[string]bool) []*decoder.Assignment {
+	var preempted []*decoder.Assignment
+	for _, a := range s.InitialState {
+		if v, ok := model[a.Encode()]; a.Value && ok && !v {
+			preempted = append(preempted, a)
+		}
+	}
+	return preempted
+}
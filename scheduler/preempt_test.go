@@ -0,0 +1,131 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func busyWorkers(n int) (*Scheduler, *encoder.Test) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+	s := NewScheduler(workers, tests)
+
+	for i := 1; i <= n; i++ {
+		w := workers.NewWorker("host")
+		w.Instance = i
+		w.AddWorkerClass("qemu64")
+
+		low := encoder.NewTest(fmt.Sprintf("low%d", i))
+		low.AddWorkerClass("qemu64")
+		low.SetPriority(10)
+		s.InitialState = append(s.InitialState, decoder.NewAssignment(low, w, common.STATE_CURRENT, true))
+	}
+
+	high := tests.NewTest("high")
+	high.AddWorkerClass("qemu64")
+	high.SetPriority(50)
+
+	return s, high
+}
+
+func TestBusyWorker(t *testing.T) {
+	s, _ := busyWorkers(1)
+
+	if _, err := s.ScheduleDecode(); err == nil {
+		t.Error("Test assigned to a busy worker")
+	}
+}
+
+func TestPreemption(t *testing.T) {
+	s, _ := busyWorkers(3)
+	s.Preemption = true
+
+	ass, err := s.ScheduleDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Preempted) != 1 {
+		t.Fatal("Expected exactly one preemption", s.Preempted)
+	}
+
+	for _, a := range ass {
+		if a.Value {
+			if a.Test.Name != "high" || a.Worker.Instance != s.Preempted[0].Worker.Instance {
+				t.Error("Wrong assignment", a.Test.Name, a.Worker.Instance)
+			}
+		}
+	}
+}
+
+func TestPreemptionPriority(t *testing.T) {
+	s, high := busyWorkers(2)
+	s.Preemption = true
+	high.SetPriority(10)
+
+	if _, err := s.ScheduleDecode(); err == nil {
+		t.Error("Running test preempted by a test with the same priority")
+	}
+	if len(s.Preempted) != 0 {
+		t.Error("Running test preempted", s.Preempted)
+	}
+}
+
+func TestHostOverCapacityPreemption(t *testing.T) {
+	s, _ := busyWorkers(3)
+	s.SetHostCapacity("host", 1)
+	s.AllowPending = true
+
+	res, err := s.Plan()
+	if err != nil {
+		t.Fatal("Host over capacity blocks the schedule:", err)
+	}
+	if len(res.Pending) != 1 || len(res.Unchanged) != 3 {
+		t.Error("Expected the running tests kept and high pending", res.Pending, res.Unchanged)
+	}
+
+	other := s.WorkerCollection.NewWorker("other")
+	other.AddWorkerClass("qemu64")
+	for _, preemption := range []bool{false, true} {
+		s.Preemption = preemption
+		res, err = s.Plan()
+		if err != nil {
+			t.Fatal("Host over capacity blocks the schedule:", err)
+		}
+		if len(res.Assigned) != 1 || res.Assigned[0].Worker.Name != "other" || len(res.Preempted) != 0 {
+			t.Error("Expected high on the other host", res.Assigned, res.Preempted)
+		}
+	}
+}
+
+func TestHostCapacityPreemption(t *testing.T) {
+	s, _ := busyWorkers(2)
+	s.SetHostCapacity("host", 2)
+	s.Preemption = true
+
+	res, err := s.Plan()
+	if err != nil {
+		t.Fatal("Preempted test doesn't free its slot of the host:", err)
+	}
+	if len(res.Assigned) != 1 || len(res.Preempted) != 1 {
+		t.Error("Expected high to take over a preempted slot", res.Assigned, res.Preempted)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// PendingTest is a test left unassigned, and why
+type PendingTest struct {
+	Test   *encoder.Test `json:"test"`
+	Reason string        `json:"reason"`
+}
+
+// ScheduleResult is the outcome of a schedule run
+type ScheduleResult struct {
+	// Assigned are the new assignments
+	Assigned []*decoder.Assignment `json:"assigned"`
+	// Unchanged are the running assignments of the initial state carried over
+	Unchanged []*decoder.Assignment `json:"unchanged"`
+	// Preempted are the running assignments to cancel
+	Preempted []*decoder.Assignment `json:"preempted,omitempty"`
+	// Released are the assignments dropped as their worker went offline
+	Released []*decoder.Assignment `json:"released,omitempty"`
+	Pending  []*PendingTest        `json:"pending"`
+	// IdleWorkers are the online workers left without tests
+	IdleWorkers []*encoder.Worker      `json:"idle_workers"`
+	Groups      map[string]*GroupUsage `json:"groups,omitempty"`
+	Missed      []*MissedDeadline      `json:"missed_deadlines,omitempty"`
+
+	Stats      *SolverStats  `json:"stats"`
+	BuildTime  time.Duration `json:"build_time"`
+	SolveTime  time.Duration `json:"solve_time"`
+	DecodeTime time.Duration `json:"decode_time"`
+}
+
+func (r *ScheduleResult) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Plan builds the formula, solves it and returns the structured result.
+// When tests can't be assigned, the result is returned along with the error,
+// with solver statistics and every test pending.
+func (s *Scheduler) Plan() (*ScheduleResult, error) {
+	return s.PlanContext(context.Background())
+}
+
+// PlanContext is Plan stopping the search for cheaper models when ctx is
+// done, see SolveContext
+func (s *Scheduler) PlanContext(ctx context.Context) (*ScheduleResult, error) {
+	res, err := s.plan(ctx)
+	if s.Metrics != nil {
+		s.Metrics.ObserveSchedule(res, err)
+	}
+	return res, err
+}
+
+func (s *Scheduler) plan(ctx context.Context) (*ScheduleResult, error) {
+	res := &ScheduleResult{}
+
+	if err := s.validate(); err != nil {
+		for _, t := range s.TestCollection.Tests {
+			res.Pending = append(res.Pending, &PendingTest{Test: t, Reason: common.PENDING_INVALID})
+		}
+		return res, err
+	}
+
+	defer s.release()()
+	start := time.Now()
+	f := s.BuildFormula()
+	res.BuildTime = time.Since(start)
+	res.Released = s.Released
+
+	start = time.Now()
+	model, _, err := s.SolveContext(ctx, f)
+	res.SolveTime = time.Since(start)
+	res.Stats = s.Stats
+	if err != nil {
+		for _, t := range s.TestCollection.Tests {
+			res.Pending = append(res.Pending, &PendingTest{Test: t, Reason: common.PENDING_UNSATISFIABLE})
+		}
+		return res, err
+	}
+
+	start = time.Now()
+	ass, err := s.decode(model)
+	if err != nil {
+		return res, err
+	}
+	for _, a := range ass {
+		if a.Value {
+			res.Assigned = append(res.Assigned, a)
+		}
+	}
+	for _, a := range s.InitialState {
+		if a.Value && model[a.Encode()] {
+			res.Unchanged = append(res.Unchanged, a)
+		}
+	}
+	res.Preempted = s.PreemptedAssignments(model)
+	res.Groups = s.GroupUsage(model)
+	res.Missed = s.MissedDeadlines(model)
+	res.Pending = s.pendingReasons(model, res.Groups)
+	res.IdleWorkers = s.IdleWorkers(model)
+	res.DecodeTime = time.Since(start)
+
+	s.Preempted, s.Groups, s.Missed = res.Preempted, res.Groups, res.Missed
+	return res, nil
+}
+
+func (s *Scheduler) pendingReasons(model map[string]bool, groups map[string]*GroupUsage) []*PendingTest {
+	var pending []*PendingTest
+	for _, t := range s.PendingTests(model) {
+		matched, provided, online := false, false, false
+		for _, w := range s.WorkerCollection.Workers {
+			if s.Classes.Matches(w, t) || len(t.WorkerClass) == 0 && len(t.Requirements) > 0 {
+				matched = true
+			}
+			if s.Classes.Satisfies(w, t) {
+				provided = true
+				if s.canRun(w, t) {
+					online = true
+				}
+			}
+		}
+
+		reason := common.PENDING_NO_FREE_WORKER
+		if !matched {
+			reason = common.PENDING_NO_WORKER_CLASS
+		} else if !provided {
+			reason = common.PENDING_NO_CAPABLE_WORKER
+		} else if s.WaitingForParent(t) {
+			reason = common.PENDING_PARENT
+		} else if !online {
+			reason = common.PENDING_NO_ONLINE_WORKER
+		} else if quota, ok := s.GroupQuota[t.Group]; ok {
+			if g := groups[t.Group]; g != nil && g.Running+g.Assigned >= quota {
+				reason = common.PENDING_GROUP_QUOTA
+			}
+		}
+		pending = append(pending, &PendingTest{Test: t, Reason: reason})
+	}
+	return pending
+}
+
+// IdleWorkers returns the online workers without any running or new test in model
+func (s *Scheduler) IdleWorkers(model map[string]bool) []*encoder.Worker {
+	busy := make(map[*encoder.Worker]bool)
+	for _, a := range s.InitialState {
+		if a.Value && model[a.Encode()] {
+			busy[s.resolveWorker(a.Worker)] = true
+		}
+	}
+	for _, a := range s.assignments(model) {
+		if a.Value {
+			busy[a.Worker] = true
+		}
+	}
+
+	var idle []*encoder.Worker
+	for _, w := range s.WorkerCollection.Workers {
+		if w.AcceptsJobs() && !busy[w] {
+			idle = append(idle, w)
+		}
+	}
+	return idle
+}
@@ -0,0 +1,166 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func TestPlan(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	w1 := workers.NewWorker("mudler")
+	w1.AddWorkerClass("developer")
+	workers.NewWorker("mudler_away").AddWorkerClass("developer")
+	w3 := workers.NewWorker("boss")
+	w3.AddWorkerClass("manager")
+	w3.SetStatus(common.WORKER_DRAINING)
+	idle := workers.NewWorker("intern")
+	idle.AddWorkerClass("intern")
+
+	build := encoder.NewTest("build")
+	build.AddWorkerClass("developer")
+	tests.NewTest("lunch").AddWorkerClass("developer")
+	tests.NewTest("hiking")
+	tests.NewTest("meeting").AddWorkerClass("manager")
+
+	s := NewScheduler(workers, tests)
+	s.AllowPending = true
+	s.InitialState = []*decoder.Assignment{decoder.NewAssignment(build, w1, common.STATE_CURRENT, true)}
+
+	res, err := s.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Assigned) != 1 || res.Assigned[0].Test.Name != "lunch" || res.Assigned[0].Worker.Name != "mudler_away" {
+		t.Error("Wrong new assignments", res.Assigned)
+	}
+	if len(res.Unchanged) != 1 || res.Unchanged[0].Test.Name != "build" {
+		t.Error("Running assignment not carried over", res.Unchanged)
+	}
+	if len(res.IdleWorkers) != 1 || res.IdleWorkers[0] != idle {
+		t.Error("Wrong idle workers", res.IdleWorkers)
+	}
+
+	reasons := make(map[string]string)
+	for _, p := range res.Pending {
+		reasons[p.Test.Name] = p.Reason
+	}
+	if reasons["hiking"] != common.PENDING_NO_WORKER_CLASS || reasons["meeting"] != common.PENDING_NO_ONLINE_WORKER || len(reasons) != 2 {
+		t.Error("Wrong pending tests", reasons)
+	}
+	if res.Stats == nil || res.Stats.Variables == 0 || res.Stats.Cost != 2*PendingWeight {
+		t.Error("Wrong solver statistics", res.Stats)
+	}
+
+	data, err := res.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"assigned", "unchanged", "pending", "idle_workers", "stats", "solve_time"} {
+		if _, ok := decoded[k]; !ok {
+			t.Error("Missing key in JSON result", k)
+		}
+	}
+}
+
+func TestPlanUnsatisfiable(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	workers.NewWorker("mudler").AddWorkerClass("developer")
+	tests.NewTest("lunch").AddWorkerClass("developer")
+	tests.NewTest("meeting").AddWorkerClass("developer")
+
+	s := NewScheduler(workers, tests)
+	res, err := s.Plan()
+	if err == nil {
+		t.Fatal("Two tests assigned to a single worker")
+	}
+	if len(res.Pending) != 2 || res.Pending[0].Reason != common.PENDING_UNSATISFIABLE || res.Stats.Cost != -1 {
+		t.Error("Wrong result", res.Pending, res.Stats)
+	}
+}
+
+func TestPlanRequirements(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	small := workers.NewWorker("small")
+	small.AddWorkerClass("qemu_x86_64")
+	small.SetProperty("memory_gb", "8")
+	big := workers.NewWorker("big")
+	big.AddWorkerClass("qemu_x86_64")
+	big.SetProperty("memory_gb", "64")
+
+	for _, name := range []string{"install", "huge"} {
+		test := tests.NewTest(name)
+		test.AddWorkerClass("qemu_x86_64")
+		if err := test.AddRequirement("memory_gb >= 16"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests.FindTest("huge").AddRequirement("memory_gb > 64")
+
+	s := NewScheduler(workers, tests)
+	s.AllowPending = true
+	res, err := s.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Assigned) != 1 || res.Assigned[0].Test.Name != "install" || res.Assigned[0].Worker != big {
+		t.Error("Wrong assignments", res.Assigned)
+	}
+	if len(res.Pending) != 1 || res.Pending[0].Reason != common.PENDING_NO_CAPABLE_WORKER {
+		t.Error("Wrong pending tests", res.Pending)
+	}
+	if s.canRun(small, tests.FindTest("install")) {
+		t.Error("Expected the workers not meeting the requirements pre-filtered")
+	}
+}
+
+func TestPlanContext(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+	workers.NewWorker("openqaworker1").AddWorkerClass("qemu_x86_64")
+	tests.NewTest("textmode").AddWorkerClass("qemu_x86_64")
+	s := NewScheduler(workers, tests)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.PlanContext(ctx); err != context.Canceled {
+		t.Error("Planned after the context was cancelled", err)
+	}
+
+	s.SolveTimeout = time.Nanosecond
+	res, err := s.PlanContext(context.Background())
+	if err != nil || len(res.Assigned) != 1 {
+		t.Error("Expected the first model within the timeout", res, err)
+	}
+}
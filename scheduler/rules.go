@@ -0,0 +1,104 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/crillab/gophersat/bf"
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// runningAssignment returns the running assignment of the initial state of
+// the test with the given name, or nil
+func (s *Scheduler) runningAssignment(name string) *decoder.Assignment {
+	for _, a := range s.InitialState {
+		if a.Value && a.Test != nil && a.Worker != nil && a.Test.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// BuildRulesFormula returns the constraints of the affinity rules between tests.
+// Hard rules are plain clauses, soft rules get a violation variable for each
+// pair of tests, penalized with the rule weight. A queued test is placed
+// according to the host of the tests of its rules already running, as long
+// as they are kept. Rules of unknown type are rejected by Validate.
+func (s *Scheduler) BuildRulesFormula() bf.Formula {
+	f := bf.True
+	if s.Rules == nil {
+		return f
+	}
+
+	for i, r := range s.Rules.Rules {
+		if r.Type != common.RULE_AFFINITY && r.Type != common.RULE_ANTI_AFFINITY {
+			continue
+		}
+		for x := 0; x < len(r.Tests); x++ {
+			for y := x + 1; y < len(r.Tests); y++ {
+				a := s.TestCollection.FindTest(r.Tests[x])
+				b := s.TestCollection.FindTest(r.Tests[y])
+				var running *decoder.Assignment
+				switch {
+				case a != nil && b == nil:
+					running = s.runningAssignment(r.Tests[y])
+				case a == nil && b != nil:
+					a, running = b, s.runningAssignment(r.Tests[x])
+				}
+				if a == nil || b == nil && running == nil {
+					continue
+				}
+
+				var violation bf.Formula
+				if !r.IsHard() {
+					v := fmt.Sprintf(common.RuleViolationFmt, i, r.Tests[x], r.Tests[y])
+					s.AddPenalty(v, r.Weight)
+					violation = bf.Var(v)
+				}
+				apart := r.Type == common.RULE_ANTI_AFFINITY
+				if running != nil {
+					f = and(f, s.colocateRunning(a, running, apart, violation))
+				} else {
+					f = and(f, s.colocate(a, b, apart, violation))
+				}
+			}
+		}
+	}
+
+	return f
+}
+
+// colocateRunning returns the constraints placing the test t on the host of
+// the running assignment a, or on a different one if apart is set, while a
+// is kept. As in colocate, violation is set when they don't hold if given.
+func (s *Scheduler) colocateRunning(t *encoder.Test, a *decoder.Assignment, apart bool, violation bf.Formula) bf.Formula {
+	f := bf.True
+	host := s.resolveWorker(a.Worker).GetHost()
+	for _, w := range s.WorkerCollection.Workers {
+		if !s.canRun(w, t) || (w.GetHost() == host) != apart {
+			continue
+		}
+		clause := []bf.Formula{bf.Not(bf.Var(s.Assign(w, t))), bf.Not(bf.Var(a.Encode()))}
+		if violation != nil {
+			clause = append(clause, violation)
+		}
+		f = and(f, bf.Or(clause...))
+	}
+	return f
+}
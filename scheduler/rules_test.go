@@ -0,0 +1,149 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func twoHosts() (*encoder.WorkerColl, *encoder.TestColl) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	for _, h := range []string{"host1", "host2"} {
+		for i := 1; i <= 2; i++ {
+			w := workers.NewWorker(h)
+			w.Instance = i
+			w.AddWorkerClass("qemu64")
+		}
+	}
+	tests.NewTest("usb1").AddWorkerClass("qemu64")
+	tests.NewTest("usb2").AddWorkerClass("qemu64")
+
+	return workers, tests
+}
+
+func TestHardRules(t *testing.T) {
+	workers, tests := twoHosts()
+
+	s := NewScheduler(workers, tests)
+	s.Rules = encoder.NewRuleSet()
+	s.Rules.AntiAffinity(0, "usb1", "usb2")
+	for i := 0; i < 5; i++ {
+		ass, err := s.ScheduleDecode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts := assignedHosts(ass, workers)
+		if hosts["usb1"] == hosts["usb2"] {
+			t.Error("Anti-affinity rule violated", hosts)
+		}
+	}
+
+	s.Rules = encoder.NewRuleSet()
+	s.Rules.Affinity(0, "usb1", "usb2")
+	ass, err := s.ScheduleDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := assignedHosts(ass, workers)
+	if hosts["usb1"] != hosts["usb2"] {
+		t.Error("Affinity rule violated", hosts)
+	}
+
+	s.SetHostCapacity("host1", 1)
+	s.SetHostCapacity("host2", 1)
+	if _, err := s.ScheduleDecode(); err == nil {
+		t.Error("Hard affinity rule not enforced")
+	}
+}
+
+func TestSoftRules(t *testing.T) {
+	workers, tests := twoHosts()
+
+	s := NewScheduler(workers, tests)
+	s.Rules = encoder.NewRuleSet()
+	s.Rules.AntiAffinity(10, "usb1", "usb2")
+	for i := 0; i < 5; i++ {
+		ass, err := s.ScheduleDecode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts := assignedHosts(ass, workers)
+		if hosts["usb1"] == hosts["usb2"] {
+			t.Error("Soft anti-affinity rule not preferred", hosts)
+		}
+	}
+
+	s.Rules = encoder.NewRuleSet()
+	s.Rules.Affinity(10, "usb1", "usb2")
+	ass, err := s.ScheduleDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := assignedHosts(ass, workers)
+	if hosts["usb1"] != hosts["usb2"] {
+		t.Error("Soft affinity rule not preferred", hosts)
+	}
+
+	// Soft rules can be violated when there is no other way
+	s.SetHostCapacity("host1", 1)
+	s.SetHostCapacity("host2", 1)
+	ass, err = s.ScheduleDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts = assignedHosts(ass, workers)
+	if hosts["usb1"] == hosts["usb2"] {
+		t.Error("Host capacity exceeded", hosts)
+	}
+}
+
+func TestRulesRunning(t *testing.T) {
+	workers, tests := twoHosts()
+	tests.Tests = tests.Tests[:1]
+
+	usb0 := &encoder.Test{Name: "usb0", WorkerClass: []string{"qemu64"}}
+	s := NewScheduler(workers, tests)
+	s.InitialState = []*decoder.Assignment{
+		decoder.NewAssignment(usb0, workers.FindWorker("host1", 1), common.STATE_CURRENT, true),
+	}
+	for i := 0; i < 5; i++ {
+		s.Rules = encoder.NewRuleSet()
+		s.Rules.AntiAffinity(0, "usb0", "usb1")
+		ass, err := s.ScheduleDecode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hosts := assignedHosts(ass, workers); hosts["usb1"] != "host2" {
+			t.Error("Anti-affinity with a running test violated", hosts)
+		}
+
+		s.Rules = encoder.NewRuleSet()
+		s.Rules.Affinity(10, "usb1", "usb0")
+		ass, err = s.ScheduleDecode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hosts := assignedHosts(ass, workers); hosts["usb1"] != "host1" {
+			t.Error("Soft affinity with a running test not preferred", hosts)
+		}
+	}
+}
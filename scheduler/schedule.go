@@ -16,8 +16,11 @@
 package scheduler
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/mudler/openqa-scheduler-go/common"
 
@@ -31,6 +34,70 @@ type Scheduler struct {
 	TestCollection   *encoder.TestColl
 
 	InitialState []*decoder.Assignment
+
+	// HostCapacity is the maximum number of tests running at the same time on a host
+	HostCapacity map[string]int
+	// HostPolicy is the default placement of parallel clusters on hosts
+	HostPolicy string
+
+	Rules *encoder.RuleSet
+
+	// Classes are the aliases and implications between worker classes,
+	// classes are compared by name if nil
+	Classes *encoder.ClassRegistry
+
+	// AllowPending lets tests stay pending when they can't be assigned,
+	// instead of failing the whole schedule
+	AllowPending bool
+
+	// Aging raises the priority of tests waiting for long, when AllowPending
+	// lets some of them wait
+	Aging *AgingPolicy
+	// Deadlines favours the tests closer to their deadline, when AllowPending
+	// lets the others wait
+	Deadlines *DeadlinePolicy
+	// Missed are the tests forecasted to miss their deadline after the last schedule
+	Missed []*MissedDeadline
+	// Now returns the current time, time.Now if nil
+	Now func() time.Time
+
+	// GroupQuota is the maximum number of workers used at the same time by a job group
+	GroupQuota map[string]int
+	// GroupShare is the weight of a job group when sharing the workers of each class
+	GroupShare map[string]int
+	// Groups reports the usage of each job group after the last schedule
+	Groups map[string]*GroupUsage
+
+	// Preemption allows running assignments of the initial state to be
+	// revoked in favour of tests with a strictly higher priority
+	Preemption bool
+	// Preempted are the running assignments revoked by the last schedule
+	Preempted []*decoder.Assignment
+
+	// Released are the assignments of the initial state dropped by the last
+	// Plan or Schedule because their worker went offline, their tests were
+	// queued again, see ReleaseOffline
+	Released []*decoder.Assignment
+
+	// StrictDecode fails decoding models with undecodable assignments
+	// instead of skipping them
+	StrictDecode bool
+
+	// SolveTimeout caps the search for the cheapest model, the cheapest one
+	// found by then is used and not marked optimal. There is no limit if 0.
+	SolveTimeout time.Duration
+	// Stats are the statistics of the last solve
+	Stats *SolverStats
+	// Metrics, if set, observes every Plan run
+	Metrics MetricsHook
+	// Logger records the formula construction, solving and decoding, nothing is logged if nil
+	Logger *slog.Logger
+
+	penalties map[string]int
+	// minCost is a lower bound of the cost of the formula built, and guess
+	// the values of some of its variables in a model likely to reach it
+	minCost int
+	guess   map[string]bool
 }
 
 func NewScheduler(WorkerColl *encoder.WorkerColl, TestColl *encoder.TestColl) *Scheduler {
@@ -49,8 +116,38 @@ func (s *Scheduler) TaskState(t *encoder.Test, state string) string {
 	return fmt.Sprintf(common.StateFmt, t.Encode(), state)
 }
 
+// resolveWorker returns the worker of the collection matching w, which can
+// be a copy coming from a decoded assignment
+func (s *Scheduler) resolveWorker(w *encoder.Worker) *encoder.Worker {
+	if found := s.WorkerCollection.FindWorker(w.Name, w.Instance); found != nil {
+		return found
+	}
+	return w
+}
+
+// resolveTest returns the test of the collection matching t, which can
+// be a copy coming from a decoded assignment
+func (s *Scheduler) resolveTest(t *encoder.Test) *encoder.Test {
+	if found := s.TestCollection.FindTest(t.Name); found != nil {
+		return found
+	}
+	return t
+}
+
+// canRun is the pre-filter applied before encoding an assignment
+func (s *Scheduler) canRun(w *encoder.Worker, t *encoder.Test) bool {
+	return w.AcceptsJobs() && s.Classes.Satisfies(w, t) && !s.WaitingForParent(t)
+}
+
 func (s *Scheduler) BuildFormula() bf.Formula {
 	f := bf.True
+	l := s.logger()
+	s.penalties = nil
+	l.Info("building formula", "workers", len(s.WorkerCollection.Workers), "tests", len(s.TestCollection.Tests),
+		"initial_state", len(s.InitialState))
+	for _, a := range s.InitialState {
+		a.State = common.STATE_OLD
+	}
 
 	// TODO: Consider split solving in multiple worker/tests chunks and re-run itself
 	// TODO: This is very raw and all have at least to go to binary encoding and avoid wasting cycles
@@ -62,7 +159,9 @@ func (s *Scheduler) BuildFormula() bf.Formula {
 
 		for _, w := range s.WorkerCollection.Workers {
 
-			if w.Satisfies(t) { // encoding filter by class - remove unnecessary load from solver with simple check
+			ok := s.canRun(w, t)
+			s.tracePrefilter(l, w, t, ok)
+			if ok { // encoding filter by class - remove unnecessary load from solver with simple check
 
 				// If we accept this test, not going to accept others
 				var doesnotaccept []bf.Formula = make([]bf.Formula, 0)
@@ -88,43 +187,141 @@ func (s *Scheduler) BuildFormula() bf.Formula {
 			}
 		}
 
+		if s.AllowPending {
+			vars = append(vars, s.Pending(t))
+			s.AddPenalty(s.TaskState(t, common.STATE_PENDING), s.pendingWeight(t))
+			f = and(f, s.BuildPendingFormula(t))
+		}
+
+		l.Debug("encoded test", "test", t.Name, "candidates", len(vars))
 		f = bf.And(f, bf.Or(vars...))
+		f = and(f, s.BuildParallelFormula(t))
 	}
 
+	f = and(f, s.BuildCapacityFormula())
+	s.minCost, s.guess = s.guessPending()
+	l.Debug("encoding host constraints", "hosts", len(s.HostCapacity), "policy", s.HostPolicy)
+	f = and(f, s.BuildHostFormula())
+	if s.Rules != nil {
+		l.Debug("encoding rules", "rules", len(s.Rules.Rules))
+	}
+	f = and(f, s.BuildRulesFormula())
+	l.Debug("encoding job groups", "quotas", len(s.GroupQuota), "shares", len(s.GroupShare))
+	f = and(f, s.BuildGroupFormula())
+	s.addAssetPenalties()
+
 	var vars []bf.Formula = make([]bf.Formula, 0)
 	// Apply initial state
 	if s.InitialState != nil {
-		for _, a := range s.InitialState {
-			a.State = common.STATE_OLD
-			if a.Value {
-				vars = append(vars, bf.Var(a.Encode()))
-			} else {
+		l.Debug("applying initial state", "assignments", len(s.InitialState), "preemption", s.Preemption)
+		for i, a := range s.InitialState {
+			if !a.Value {
 				vars = append(vars, bf.Not(bf.Var(a.Encode())))
+				continue
+			}
+			if s.Preemption {
+				vars = append(vars, s.preemptFormula(i, a))
+			} else {
+				vars = append(vars, bf.Var(a.Encode()))
 			}
+			vars = append(vars, s.busyFormula(a))
 		}
 		vars = append(vars, f)
 		f = bf.And(vars...)
 	}
+	l.Info("formula built", "penalties", len(s.penalties))
 	return f
 }
 
+// Solve looks for a model of f, the cheapest one if penalties were added while
+// building it. The formula is handed to the solver as pseudo-boolean constraints
+// rather than going through bf.Solve, whose CNF simplification can return
+// models violating unit clauses.
 func (s *Scheduler) Solve(f bf.Formula) (map[string]bool, bf.Formula, error) {
-	model := bf.Solve(f)
+	return s.SolveContext(context.Background(), f)
+}
+
+// SolveContext is Solve stopping the search for cheaper models when ctx is
+// done or SolveTimeout expires. It fails if ctx is done before solving.
+func (s *Scheduler) SolveContext(ctx context.Context, f bf.Formula) (map[string]bool, bf.Formula, error) {
+	l := s.logger()
+	if err := ctx.Err(); err != nil {
+		return nil, f, err
+	}
+	if s.SolveTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.SolveTimeout)
+		defer cancel()
+	}
+	model, stats, err := minimize(ctx, f, s.penalties, s.minCost, s.guess)
+	s.Stats = stats
+	if err != nil {
+		l.Error("solver failed", "error", err)
+		return model, f, err
+	}
 	if model == nil {
+		l.Warn("formula unsatisfiable", statsAttrs(stats)...)
 		return model, f, errors.New("Error: cannot assign tests to workers")
 	}
+	l.Info("formula solved", statsAttrs(stats)...)
 	return model, f, nil
 }
 
+// Schedule validates the workers and tests, builds the formula and solves it,
+// releasing the assignments of offline workers
 func (s *Scheduler) Schedule() (map[string]bool, bf.Formula, error) {
+	if err := s.validate(); err != nil {
+		return nil, nil, err
+	}
+	defer s.release()()
 	return s.Solve(s.BuildFormula())
 }
 
+// decode returns the assignments of the current state in model, referring
+// to the workers and tests of the collections
+func (s *Scheduler) decode(model map[string]bool) ([]*decoder.Assignment, error) {
+	l := s.logger()
+	d := decoder.NewCollectionDecoder(s.WorkerCollection, s.TestCollection)
+	d.Strict = s.StrictDecode
+	ass, err := d.Decode(model)
+	if err != nil {
+		l.Error("decoding model failed", "error", err)
+		return ass, err
+	}
+	assigned := 0
+	for _, a := range ass {
+		if a.Value {
+			assigned++
+			l.Debug("assignment", "test", a.Test.Name, "worker", a.Worker.Encode())
+		}
+	}
+	l.Info("model decoded", "assignments", assigned)
+	return ass, nil
+}
+
+// assignments returns the decodable assignments of the current state in model
+func (s *Scheduler) assignments(model map[string]bool) []*decoder.Assignment {
+	return decoder.NewCollectionDecoder(s.WorkerCollection, s.TestCollection).DecodeModel(model)
+}
+
 func (s *Scheduler) ScheduleDecode() ([]*decoder.Assignment, error) {
-	model, _, err := s.Schedule()
+	s.Preempted = nil
+	s.Groups = nil
+	s.Missed = nil
+	if err := s.validate(); err != nil {
+		return []*decoder.Assignment{}, err
+	}
+	defer s.release()()
+	model, _, err := s.Solve(s.BuildFormula())
 	if err != nil {
 		return []*decoder.Assignment{}, err
 	}
-	ass := decoder.DecodeModel(model)
+	ass, err := s.decode(model)
+	if err != nil {
+		return ass, err
+	}
+	s.Preempted = s.PreemptedAssignments(model)
+	s.Groups = s.GroupUsage(model)
+	s.Missed = s.MissedDeadlines(model)
 	return ass, nil
 }
@@ -89,3 +89,49 @@ func TestInitialState(t *testing.T) {
 		t.Error("New assignment")
 	}
 }
+
+func TestDecodedIdentity(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	w1 := workers.NewWorker("mudler")
+	t1 := tests.NewTest("lunch")
+
+	w1.AddWorkerClass("developer")
+	w1.SetHost("home")
+	t1.AddWorkerClass("developer")
+	t1.SetPriority(10)
+
+	s := NewScheduler(workers, tests)
+	ass, err := s.ScheduleDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ass) != 1 || ass[0].Worker != w1 || ass[0].Test != t1 {
+		t.Fatal("Decoded assignment doesn't refer to the collections", ass)
+	}
+	if ass[0].Worker.Host != "home" || ass[0].Test.Priority != 10 {
+		t.Error("Decoded assignment lost metadata", ass[0].Worker, ass[0].Test)
+	}
+}
+
+func TestStrictDecode(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	w1 := workers.NewWorker("mudler")
+	t1 := tests.NewTest("lunch")
+
+	w1.AddWorkerClass("developer")
+	t1.AddWorkerClass("developer")
+
+	s := NewScheduler(workers, tests)
+	s.StrictDecode = true
+	ass, err := s.ScheduleDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ass) != 1 || ass[0].Worker != w1 || ass[0].Test != t1 {
+		t.Error("Decoded assignment doesn't refer to the collections", ass)
+	}
+}
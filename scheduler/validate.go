@@ -0,0 +1,239 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+// ValidationError is a problem of the workers or tests of a scheduler
+type ValidationError struct {
+	// Kind is one of common.INVALID_*
+	Kind string `json:"kind"`
+	// Worker and Test name what the problem is about, if anything
+	Worker  string `json:"worker,omitempty"`
+	Test    string `json:"test,omitempty"`
+	Message string `json:"message"`
+	// Warning is set for problems which don't prevent scheduling
+	Warning bool `json:"warning,omitempty"`
+}
+
+func (e *ValidationError) Error() string {
+	switch {
+	case e.Worker != "":
+		return "worker " + e.Worker + ": " + e.Message
+	case e.Test != "":
+		return "test " + e.Test + ": " + e.Message
+	}
+	return e.Message
+}
+
+// ValidationErrors are all the problems found by a validation
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return "Invalid input: " + strings.Join(msgs, "; ")
+}
+
+// Errors returns the problems preventing scheduling
+func (errs ValidationErrors) Errors() ValidationErrors {
+	var res ValidationErrors
+	for _, e := range errs {
+		if !e.Warning {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// Warnings returns the problems which don't prevent scheduling
+func (errs ValidationErrors) Warnings() ValidationErrors {
+	var res ValidationErrors
+	for _, e := range errs {
+		if e.Warning {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// Separators of the encoding, which names can't contain
+var (
+	reservedInWorkerName = []string{common.AssignSep, common.StateSep, common.WorkerSep, common.WorkerInstSep}
+	reservedInTestName   = []string{common.AssignSep, common.StateSep, common.TestSep, common.TestParallelSep}
+	reservedInClass      = []string{common.AssignSep, common.StateSep, common.WorkerSep, common.WorkerClassSep}
+)
+
+func reserved(s string, seps []string) string {
+	for _, sep := range seps {
+		if strings.Contains(s, sep) {
+			return sep
+		}
+	}
+	return ""
+}
+
+func validHostPolicy(p string) bool {
+	switch p {
+	case "", common.HOST_POLICY_ANY, common.HOST_POLICY_SAME, common.HOST_POLICY_SPREAD:
+		return true
+	}
+	return false
+}
+
+// Validate checks the workers and tests before any formula is built, and
+// returns all the problems found: names the encoding can't hold, duplicate
+// workers and tests, tests parallel to themselves or to unknown tests,
+// cyclic parents, unknown host policies and rule types, and cyclic worker
+// classes. A parent neither queued nor running is only a warning, it is
+// assumed to be finished, and so are aging and deadline policies without
+// AllowPending.
+func (s *Scheduler) Validate() ValidationErrors {
+	var errs ValidationErrors
+	add := func(kind, worker, test string, format string, args ...interface{}) *ValidationError {
+		e := &ValidationError{Kind: kind, Worker: worker, Test: test, Message: fmt.Sprintf(format, args...)}
+		errs = append(errs, e)
+		return e
+	}
+	checkClasses := func(worker, test string, classes []string) {
+		for _, c := range classes {
+			if sep := reserved(c, reservedInClass); sep != "" {
+				add(common.INVALID_NAME, worker, test, "worker class %q contains %q", c, sep)
+			}
+		}
+	}
+
+	if !validHostPolicy(s.HostPolicy) {
+		add(common.INVALID_HOST_POLICY, "", "", "unknown default host policy %q", s.HostPolicy)
+	}
+	if s.Classes != nil {
+		if err := s.Classes.Validate(); err != nil {
+			add(common.INVALID_CLASSES, "", "", "%v", err)
+		}
+	}
+	if s.Aging != nil && !s.AllowPending {
+		add(common.INVALID_NO_PENDING, "", "", "aging policy without pending tests allowed has no effect").Warning = true
+	}
+	if s.Deadlines != nil && !s.AllowPending {
+		add(common.INVALID_NO_PENDING, "", "", "deadline policy without pending tests allowed has no effect").Warning = true
+	}
+	if s.Rules != nil {
+		for _, r := range s.Rules.Rules {
+			if r.Type != common.RULE_AFFINITY && r.Type != common.RULE_ANTI_AFFINITY {
+				add(common.INVALID_RULE_TYPE, "", "", "unknown type %q of the rule on %s", r.Type, strings.Join(r.Tests, ", "))
+			}
+		}
+	}
+
+	seenWorkers := make(map[string]bool)
+	for _, w := range s.WorkerCollection.Workers {
+		if w.Name == "" {
+			add(common.INVALID_NAME, "", "", "worker with an empty name")
+		} else if sep := reserved(w.Name, reservedInWorkerName); sep != "" {
+			add(common.INVALID_NAME, w.Name, "", "name contains %q", sep)
+		}
+		checkClasses(w.Name, "", w.WorkerClass)
+		id := fmt.Sprintf("%s:%d", w.Name, w.Instance)
+		if seenWorkers[id] {
+			add(common.INVALID_DUPLICATE_WORKER, w.Name, "", "instance %d listed more than once", w.Instance)
+		}
+		seenWorkers[id] = true
+	}
+
+	queued := make(map[string]*encoder.Test)
+	for _, t := range s.TestCollection.Tests {
+		if t.Name == "" {
+			add(common.INVALID_NAME, "", "", "test with an empty name")
+		} else if sep := reserved(t.Name, reservedInTestName); sep != "" {
+			add(common.INVALID_NAME, "", t.Name, "name contains %q", sep)
+		}
+		checkClasses("", t.Name, t.WorkerClass)
+		if !validHostPolicy(t.HostPolicy) {
+			add(common.INVALID_HOST_POLICY, "", t.Name, "unknown host policy %q", t.HostPolicy)
+		}
+		if _, ok := queued[t.Name]; ok {
+			add(common.INVALID_DUPLICATE_TEST, "", t.Name, "listed more than once")
+			continue
+		}
+		queued[t.Name] = t
+	}
+	running := make(map[string]bool)
+	for _, a := range s.InitialState {
+		if a.Value && a.Test != nil {
+			running[a.Test.Name] = true
+		}
+	}
+
+	for _, t := range s.TestCollection.Tests {
+		for _, p := range t.Parallel {
+			switch {
+			case p == t.Name:
+				add(common.INVALID_SELF_PARALLEL, "", t.Name, "parallel to itself")
+			case queued[p] == nil && !running[p]:
+				add(common.INVALID_UNKNOWN_PEER, "", t.Name, "parallel to %s, which is neither queued nor running", p)
+			}
+		}
+		if t.Parent != "" && queued[t.Parent] == nil && !running[t.Parent] {
+			add(common.INVALID_UNKNOWN_PARENT, "", t.Name, "parent %s is neither queued nor running, assumed finished", t.Parent).Warning = true
+		}
+	}
+
+	// Parent links are followed from each test, each cycle is reported once
+	done := make(map[string]bool)
+	for _, t := range s.TestCollection.Tests {
+		path := []string{}
+		onPath := make(map[string]bool)
+		for cur := t; cur != nil && !done[cur.Name]; cur = queued[cur.Parent] {
+			path = append(path, cur.Name)
+			if onPath[cur.Name] {
+				start := 0
+				for path[start] != cur.Name {
+					start++
+				}
+				add(common.INVALID_PARENT_CYCLE, "", cur.Name, "cyclic parents %s", strings.Join(path[start:], " -> "))
+				break
+			}
+			onPath[cur.Name] = true
+		}
+		for name := range onPath {
+			done[name] = true
+		}
+	}
+	return errs
+}
+
+// validate logs the problems of the workers and tests, and returns the ones
+// preventing scheduling as an error
+func (s *Scheduler) validate() error {
+	l := s.logger()
+	errs := s.Validate()
+	for _, e := range errs.Warnings() {
+		l.Warn("validation warning", "kind", e.Kind, "problem", e.Error())
+	}
+	if errs = errs.Errors(); len(errs) > 0 {
+		l.Error("invalid input", "problems", len(errs), "error", errs.Error())
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package scheduler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mudler/openqa-scheduler-go/common"
+	"github.com/mudler/openqa-scheduler-go/decoder"
+	"github.com/mudler/openqa-scheduler-go/encoder"
+)
+
+func TestValidate(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	workers.NewWorker("mudler").AddWorkerClass("developer")
+	workers.NewWorker("mudler").AddWorkerClass("developer")
+	workers.NewWorker("mudler#away").AddWorkerClass("developer,cook")
+
+	self := tests.NewTest("self")
+	self.AddParallel("self")
+	tests.NewTest("server").AddParallel("client")
+	tests.NewTest("a").SetParent("b")
+	tests.NewTest("b").SetParent("c")
+	tests.NewTest("c").SetParent("a")
+	tests.NewTest("d").SetParent("a")
+	tests.NewTest("lunch").SetParent("cook")
+	tests.NewTest("lunch")
+	tests.NewTest("spread").SetHostPolicy("everywhere")
+
+	s := NewScheduler(workers, tests)
+	s.Rules = encoder.NewRuleSet()
+	s.Rules.NewRule("nearby", 0, "a", "b")
+	s.Classes = encoder.NewClassRegistry()
+	s.Classes.AddImplication("64bit", "64bit")
+	var got []string
+	for _, e := range s.Validate() {
+		got = append(got, e.Kind+" "+e.Error())
+	}
+	expected := []string{
+		common.INVALID_CLASSES + " Invalid worker classes: cyclic implications 64bit -> 64bit",
+		common.INVALID_RULE_TYPE + ` unknown type "nearby" of the rule on a, b`,
+		common.INVALID_DUPLICATE_WORKER + " worker mudler: instance 0 listed more than once",
+		common.INVALID_NAME + ` worker mudler#away: name contains "#"`,
+		common.INVALID_NAME + ` worker mudler#away: worker class "developer,cook" contains ","`,
+		common.INVALID_DUPLICATE_TEST + " test lunch: listed more than once",
+		common.INVALID_HOST_POLICY + ` test spread: unknown host policy "everywhere"`,
+		common.INVALID_SELF_PARALLEL + " test self: parallel to itself",
+		common.INVALID_UNKNOWN_PEER + " test server: parallel to client, which is neither queued nor running",
+		common.INVALID_UNKNOWN_PARENT + " test lunch: parent cook is neither queued nor running, assumed finished",
+		common.INVALID_PARENT_CYCLE + " test a: cyclic parents a -> b -> c -> a",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Wrong problems:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+	if len(s.Validate().Warnings()) != 1 || len(s.Validate().Errors()) != len(expected)-1 {
+		t.Error("Wrong warnings", s.Validate().Warnings())
+	}
+
+	res, err := s.Plan()
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != len(expected)-1 {
+		t.Fatal("Expected the validation errors", err)
+	}
+	if len(res.Pending) != len(tests.Tests) || res.Pending[0].Reason != common.PENDING_INVALID || s.Stats != nil {
+		t.Error("Expected all tests pending before solving", res.Pending)
+	}
+	if _, _, err := s.Schedule(); err == nil {
+		t.Error("Invalid input scheduled")
+	}
+}
+
+func TestValidateRunning(t *testing.T) {
+	tests := encoder.NewTestColl()
+	workers := encoder.NewWorkerColl()
+
+	w := workers.NewWorker("mudler")
+	w.AddWorkerClass("developer")
+	cook := &encoder.Test{Name: "cook", Parallel: []string{"lunch"}}
+	lunch := tests.NewTest("lunch")
+	lunch.SetParent("cook")
+	lunch.AddParallel("cook")
+
+	s := NewScheduler(workers, tests)
+	s.InitialState = []*decoder.Assignment{decoder.NewAssignment(cook, w, common.STATE_CURRENT, true)}
+	if errs := s.Validate(); len(errs) != 0 {
+		t.Error("Running tests not known to the validation", errs)
+	}
+
+	s.InitialState = nil
+	if errs := s.Validate(); len(errs.Errors()) != 1 || len(errs.Warnings()) != 1 {
+		t.Error("Expected an unknown peer and parent", errs)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright © 2018 SUSE LLC
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mudler/openqa-scheduler-go/scenario"
+	"github.com/mudler/openqa-scheduler-go/scheduler"
+)
+
+// validation is the outcome of validating a scenario file
+type validation struct {
+	Scenario string                     `json:"scenario"`
+	Error    string                     `json:"error,omitempty"`
+	Problems scheduler.ValidationErrors `json:"problems,omitempty"`
+}
+
+// validateScenario loads the scenario at path and validates its workers and tests
+func validateScenario(path string) *validation {
+	v := &validation{Scenario: path}
+	sc, err := scenario.Load(path)
+	if err != nil {
+		v.Error = err.Error()
+		return v
+	}
+	s, err := sc.Scheduler()
+	if err != nil {
+		v.Error = err.Error()
+		return v
+	}
+	v.Problems = s.Validate()
+	return v
+}
+
+// validateCommand checks scenario files without scheduling them. It fails if
+// a scenario can't be loaded or has problems preventing scheduling,
+// warnings are printed only.
+func validateCommand(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the problems as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: openqa-scheduler-go validate [-json] scenario.json...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	code := 0
+	var res []*validation
+	for _, path := range flags.Args() {
+		v := validateScenario(path)
+		if v.Error != "" || len(v.Problems.Errors()) > 0 {
+			code = 1
+		}
+		res = append(res, v)
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error", err)
+			return 1
+		}
+		fmt.Println(string(data))
+		return code
+	}
+	for _, v := range res {
+		switch {
+		case v.Error != "":
+			fmt.Println(v.Scenario+": error:", v.Error)
+		case len(v.Problems) == 0:
+			fmt.Println(v.Scenario + ": ok")
+		}
+		for _, p := range v.Problems {
+			level := "error"
+			if p.Warning {
+				level = "warning"
+			}
+			fmt.Printf("%s: %s: %s (%s)\n", v.Scenario, level, p.Error(), p.Kind)
+		}
+	}
+	return code
+}